@@ -0,0 +1,338 @@
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/arkag/dirclean/fileutils"
+)
+
+// ManifestName is the tar member, written last, that lists every archived
+// file. A copy is also written next to the archive with ManifestSuffix.
+const (
+	ManifestName   = "MANIFEST.jsonl"
+	ManifestSuffix = ".manifest.jsonl"
+)
+
+// Entry describes an archived file
+type Entry struct {
+	OriginalPath string      `json:"original_path"`
+	Name         string      `json:"name"`
+	Size         int64       `json:"size"`
+	Mode         os.FileMode `json:"mode"`
+	ModTime      time.Time   `json:"mtime"`
+	SHA256       string      `json:"sha256,omitempty"`
+	LinkTarget   string      `json:"link_target,omitempty"`
+}
+
+// Extension returns the file extension of an archive in the given format
+func Extension(format string) string {
+	return ".tar" + fileutils.CompressionExtension(format)
+}
+
+// Create writes paths into a new compressed tar archive in dir named after
+// the rule and the current time, verifies it, and returns its path and
+// manifest. Files that cannot be read are left out and reported in the
+// returned error; the archive is only kept if at least one file was added.
+func Create(dir, rule, format string, paths []string) (string, []Entry, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", nil, fmt.Errorf("error creating archive directory: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".archive-*.partial")
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating archive: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	entries, skipped := write(tmp, format, paths)
+	closeErr := tmp.Close()
+	if entries == nil {
+		return "", nil, errors.Join(append(skipped, closeErr)...)
+	}
+	if closeErr != nil {
+		return "", nil, fmt.Errorf("error writing archive: %v", closeErr)
+	}
+
+	if err := Verify(tmp.Name(), format, entries); err != nil {
+		return "", nil, fmt.Errorf("archive verification failed: %v", err)
+	}
+
+	target, err := reserveName(dir, rule, format)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		os.Remove(target)
+		return "", nil, fmt.Errorf("error renaming archive: %v", err)
+	}
+	if err := writeManifestFile(target+ManifestSuffix, entries); err != nil {
+		return target, entries, err
+	}
+	return target, entries, errors.Join(skipped...)
+}
+
+// Verify reads an archive back and checks that it contains every entry with
+// the recorded checksum
+func Verify(archivePath, format string, entries []Entry) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder, err := fileutils.NewDecompressReader(bufio.NewReader(f), format)
+	if err != nil {
+		return err
+	}
+	defer decoder.Close()
+
+	want := make(map[string]Entry, len(entries))
+	for _, entry := range entries {
+		want[entry.Name] = entry
+	}
+
+	reader := tar.NewReader(decoder)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if header.Name == ManifestName {
+			continue
+		}
+		entry, ok := want[header.Name]
+		if !ok {
+			return fmt.Errorf("unexpected member %s", header.Name)
+		}
+		if header.Typeflag == tar.TypeReg {
+			hash := sha256.New()
+			if _, err := io.Copy(hash, reader); err != nil {
+				return fmt.Errorf("error reading %s: %v", header.Name, err)
+			}
+			if sum := hex.EncodeToString(hash.Sum(nil)); sum != entry.SHA256 {
+				return fmt.Errorf("checksum mismatch for %s", header.Name)
+			}
+		} else if header.Linkname != entry.LinkTarget {
+			return fmt.Errorf("link target mismatch for %s", header.Name)
+		}
+		delete(want, header.Name)
+	}
+	for name := range want {
+		return fmt.Errorf("missing member %s", name)
+	}
+	return nil
+}
+
+// Unchanged reports whether the file at the entry's original path still has
+// the size and modification time it had when it was archived
+func (e Entry) Unchanged() error {
+	info, err := os.Lstat(e.OriginalPath)
+	if err != nil {
+		return err
+	}
+	if info.Size() != e.Size || !info.ModTime().Equal(e.ModTime) {
+		return fmt.Errorf("file changed after it was archived")
+	}
+	return nil
+}
+
+// write streams paths and the manifest into a compressed tar on w
+func write(w io.Writer, format string, paths []string) ([]Entry, []error) {
+	buffered := bufio.NewWriter(w)
+	encoder, err := fileutils.NewCompressWriter(buffered, format)
+	if err != nil {
+		return nil, []error{err}
+	}
+	writer := tar.NewWriter(encoder)
+
+	var entries []Entry
+	var errs []error
+	for _, p := range paths {
+		entry, err := addFile(writer, p)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", p, err))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return nil, append(errs, errors.New("no files archived"))
+	}
+
+	var manifest bytes.Buffer
+	encodeManifest(&manifest, entries)
+	err = writer.WriteHeader(&tar.Header{
+		Name:     ManifestName,
+		Mode:     0644,
+		Size:     int64(manifest.Len()),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	})
+	if err == nil {
+		_, err = writer.Write(manifest.Bytes())
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err == nil {
+		err = encoder.Close()
+	}
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		return nil, append(errs, fmt.Errorf("error writing archive: %v", err))
+	}
+	return entries, errs
+}
+
+// addFile writes a regular file or symlink to the tar, checksumming file
+// contents as they are written
+func addFile(writer *tar.Writer, filePath string) (Entry, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return Entry{}, err
+	}
+	info, err := os.Lstat(absPath)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	// Regular files are opened before anything is written, so a file that
+	// cannot be read is skipped without leaving the tar stream mid-entry
+	var f *os.File
+	if info.Mode().IsRegular() {
+		if f, err = os.Open(absPath); err != nil {
+			return Entry{}, err
+		}
+		defer f.Close()
+		if info, err = f.Stat(); err != nil {
+			return Entry{}, err
+		}
+	}
+
+	entry := Entry{
+		OriginalPath: absPath,
+		Name:         memberName(absPath),
+		Size:         info.Size(),
+		Mode:         info.Mode(),
+		ModTime:      info.ModTime(),
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		if entry.LinkTarget, err = os.Readlink(absPath); err != nil {
+			return Entry{}, err
+		}
+	case !info.Mode().IsRegular():
+		return Entry{}, fmt.Errorf("not a regular file")
+	}
+
+	header, err := tar.FileInfoHeader(info, entry.LinkTarget)
+	if err != nil {
+		return Entry{}, err
+	}
+	header.Name = entry.Name
+	if err := writer.WriteHeader(header); err != nil {
+		return Entry{}, err
+	}
+	if entry.LinkTarget != "" {
+		return entry, nil
+	}
+
+	hash := sha256.New()
+	// The header promised info.Size() bytes, so copy exactly that many. If
+	// the file shrank meanwhile, the entry is padded to keep the stream
+	// valid and left out of the manifest.
+	n, err := io.CopyN(io.MultiWriter(writer, hash), f, info.Size())
+	if err != nil {
+		if _, padErr := io.CopyN(writer, zeroReader{}, info.Size()-n); padErr != nil {
+			return Entry{}, padErr
+		}
+		return Entry{}, fmt.Errorf("error reading file: %v", err)
+	}
+	entry.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return entry, nil
+}
+
+// zeroReader reads endless zero bytes
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// reserveName creates an empty file named <rule>-<timestamp><ext> in dir,
+// adding a counter if an archive of the same name exists
+func reserveName(dir, rule, format string) (string, error) {
+	base := fmt.Sprintf("%s-%s", safeName(rule), time.Now().Format("20060102-150405"))
+	for i := 1; ; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s-%d", base, i)
+		}
+		target := filepath.Join(dir, name+Extension(format))
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("error creating archive: %v", err)
+		}
+		f.Close()
+		return target, nil
+	}
+}
+
+func writeManifestFile(manifestPath string, entries []Entry) error {
+	var buf bytes.Buffer
+	encodeManifest(&buf, entries)
+	if err := os.WriteFile(manifestPath, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("error writing archive manifest: %v", err)
+	}
+	return nil
+}
+
+func encodeManifest(w io.Writer, entries []Entry) {
+	encoder := json.NewEncoder(w)
+	for _, entry := range entries {
+		encoder.Encode(entry)
+	}
+}
+
+// memberName turns an absolute path into a relative, slash-separated tar
+// member name, keeping a Windows drive letter as the first element
+func memberName(absPath string) string {
+	volume := filepath.VolumeName(absPath)
+	rel := strings.TrimLeft(filepath.ToSlash(strings.TrimPrefix(absPath, volume)), "/")
+	if volume != "" {
+		rel = path.Join(strings.TrimSuffix(volume, ":"), rel)
+	}
+	return rel
+}
+
+// safeName replaces characters that are awkward in file names
+func safeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+}
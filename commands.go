@@ -0,0 +1,371 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/arkag/dirclean/config"
+	"github.com/arkag/dirclean/dupes"
+	"github.com/arkag/dirclean/fileutils"
+	"github.com/arkag/dirclean/glob"
+	"github.com/arkag/dirclean/logging"
+	"github.com/arkag/dirclean/modes"
+	"github.com/arkag/dirclean/plan"
+	"github.com/arkag/dirclean/quarantine"
+)
+
+// runCommand dispatches subcommands such as "dirclean config validate". It
+// returns false when args do not name a subcommand so the regular flags are
+// parsed instead.
+func runCommand(args []string) (exitCode int, handled bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+
+	switch args[0] {
+	case "config":
+		return runConfigCommand(args[1:]), true
+	case "plan":
+		return runPlanCommand(args[1:]), true
+	case "apply":
+		return runApplyCommand(args[1:]), true
+	case "restore":
+		return runRestoreCommand(args[1:]), true
+	case "dupes":
+		return runDupesCommand(args[1:]), true
+	}
+	return 0, false
+}
+
+func runConfigCommand(args []string) int {
+	if len(args) == 0 || args[0] != "validate" {
+		fmt.Fprintln(os.Stderr, "Usage: dirclean config validate [--strict] [file]")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	strict := fs.Bool("strict", false, "Treat warnings as errors")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	configFile := "config.yaml"
+	if fs.NArg() > 0 {
+		configFile = fs.Arg(0)
+	}
+	configFile = config.ResolveConfigPath(configFile)
+
+	globalConfig, problems, err := config.ReadConfig(configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", configFile, err)
+		return 1
+	}
+
+	errorCount, warningCount := 0, 0
+	for _, problem := range problems {
+		fmt.Printf("%s:%s\n", configFile, formatProblem(problem))
+		if problem.Severity == config.SeverityError {
+			errorCount++
+		} else {
+			warningCount++
+		}
+	}
+
+	if errorCount > 0 || (*strict && warningCount > 0) {
+		fmt.Printf("%s: %d error(s), %d warning(s)\n", configFile, errorCount, warningCount)
+		return 1
+	}
+	fmt.Printf("%s: OK (%d rules, %d warning(s))\n", configFile, len(globalConfig.Rules), warningCount)
+	return 0
+}
+
+// formatProblem renders a problem as "line: severity: message" so output
+// can be parsed like compiler diagnostics
+func formatProblem(problem config.Problem) string {
+	if problem.Line > 0 {
+		return fmt.Sprintf("%d: %s: %s", problem.Line, problem.Severity, problem.Message)
+	}
+	return fmt.Sprintf(" %s: %s", problem.Severity, problem.Message)
+}
+
+// runPlanCommand records every candidate of the configured rules in a plan
+// file without deleting anything
+func runPlanCommand(args []string) int {
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	configFile := fs.String("config", "config.yaml", "Path to config file")
+	output := fs.String("o", "-", "Path to write the plan to (- for stdout)")
+	mode := fs.String("mode", "", "Only plan rules configured with this mode")
+	logFile := fs.String("log", "", "Path to log file")
+	logLevel := fs.String("log-level", "", "Log level (DEBUG, INFO, WARN, ERROR, FATAL)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	globalConfig := config.LoadConfig(*configFile)
+	initLogging(globalConfig, config.CLIFlags{LogFile: *logFile, LogLevel: *logLevel})
+
+	tempFile, err := os.CreateTemp("", "cleanup_")
+	if err != nil {
+		logging.LogMessage("FATAL", fmt.Sprintf("Error creating temp file: %v", err))
+		return 1
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	p := plan.New(logging.GenerateUUID(), config.ResolveConfigPath(*configFile))
+	modes.SetPlan(p)
+	modes.SetRunID(p.RunID)
+	for _, rule := range globalConfig.Rules {
+		if *mode != "" && rule.Mode != *mode {
+			continue
+		}
+		rule.Mode = "plan"
+		modes.ProcessFiles(rule, tempFile)
+	}
+
+	if *output == "-" {
+		if err := p.Write(os.Stdout); err != nil {
+			logging.LogMessage("ERROR", fmt.Sprintf("Error writing plan: %v", err))
+			return 1
+		}
+		return 0
+	}
+	if err := p.Save(*output); err != nil {
+		logging.LogMessage("ERROR", err.Error())
+		return 1
+	}
+	fmt.Printf("Planned %d entries (%s) in %s\n", len(p.Entries), fileutils.FormatSize(p.TotalSize()), *output)
+	fmt.Printf("Review it, then run: dirclean apply %s\n", *output)
+	return 0
+}
+
+// runApplyCommand deletes the entries of a plan file that are unchanged
+// since the plan was made
+func runApplyCommand(args []string) int {
+	fs := flag.NewFlagSet("apply", flag.ContinueOnError)
+	configFile := fs.String("config", "", "Config file to take rule settings from (default: the one the plan was made with)")
+	logFile := fs.String("log", "", "Path to log file")
+	logLevel := fs.String("log-level", "", "Log level (DEBUG, INFO, WARN, ERROR, FATAL)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: dirclean apply [--config file] [--log file] [--log-level level] <plan.json>")
+		return 2
+	}
+
+	if *logFile != "" {
+		if err := logging.InitLogging(*logFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if *logLevel != "" {
+		logging.SetLogLevel(*logLevel)
+	}
+
+	p, err := plan.Load(fs.Arg(0))
+	if err != nil {
+		logging.LogMessage("ERROR", err.Error())
+		return 1
+	}
+
+	tempFile, err := os.CreateTemp("", "cleanup_")
+	if err != nil {
+		logging.LogMessage("FATAL", fmt.Sprintf("Error creating temp file: %v", err))
+		return 1
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	// Rule settings such as quarantine_dir come from the config file
+	rules := make(map[string]config.Config)
+	if *configFile == "" {
+		*configFile = p.Config
+	}
+	if *configFile != "" {
+		globalConfig, _, err := config.ReadConfig(*configFile)
+		if err != nil {
+			logging.LogMessage("WARN", fmt.Sprintf("Could not read rule settings from %s: %v", *configFile, err))
+		}
+		for _, rule := range globalConfig.Rules {
+			rules[rule.Name] = rule
+		}
+	}
+
+	modes.SetRunID(p.RunID)
+	applied, skipped, failed := modes.ApplyPlan(p, rules, tempFile)
+	var done []string
+	for _, verb := range slices.Sorted(maps.Keys(applied)) {
+		done = append(done, fmt.Sprintf("%d %s", applied[verb], verb))
+	}
+	if len(done) == 0 {
+		done = append(done, "0 applied")
+	}
+	fmt.Printf("Applied plan %s: %s, %d skipped because they changed, %d failed\n",
+		p.RunID, strings.Join(done, ", "), skipped, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runRestoreCommand moves quarantined files back to where they came from
+func runRestoreCommand(args []string) int {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	run := fs.String("run", "", "Restore files quarantined by this run ID")
+	pathPattern := fs.String("path", "", "Restore files whose original path matches this glob")
+	configFile := fs.String("config", "config.yaml", "Config file listing the quarantine directories")
+	quarantineDir := fs.String("quarantine-dir", "", "Quarantine directory to restore from instead of those in the config")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *run == "" && *pathPattern == "" {
+		fmt.Fprintln(os.Stderr, "Usage: dirclean restore (--run <id> | --path <glob>) [--config file | --quarantine-dir dir]")
+		return 2
+	}
+
+	var matcher *glob.Glob
+	if *pathPattern != "" {
+		expanded, err := config.ExpandPath(*pathPattern)
+		if err == nil {
+			matcher, err = glob.Compile(filepath.ToSlash(expanded))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --path: %v\n", err)
+			return 2
+		}
+	}
+
+	var roots []string
+	if *quarantineDir != "" {
+		roots = []string{*quarantineDir}
+	} else {
+		globalConfig := config.LoadConfig(*configFile)
+		seen := make(map[string]bool)
+		for _, rule := range globalConfig.Rules {
+			if rule.QuarantineDir != "" && !seen[rule.QuarantineDir] {
+				seen[rule.QuarantineDir] = true
+				roots = append(roots, rule.QuarantineDir)
+			}
+		}
+	}
+	if len(roots) == 0 {
+		fmt.Fprintln(os.Stderr, "No quarantine directories configured")
+		return 1
+	}
+
+	exitCode := 0
+	total := 0
+	for _, root := range roots {
+		restored, err := quarantine.Restore(root, func(entry quarantine.Entry) bool {
+			if *run != "" && entry.RunID != *run {
+				return false
+			}
+			return matcher == nil || matcher.Match(filepath.ToSlash(entry.OriginalPath))
+		})
+		for _, entry := range restored {
+			fmt.Printf("Restored %s\n", entry.OriginalPath)
+		}
+		total += len(restored)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error restoring from %s: %v\n", root, err)
+			exitCode = 1
+		}
+	}
+	fmt.Printf("Restored %d file(s)\n", total)
+	return exitCode
+}
+
+// runDupesCommand lists files with the same contents under the given paths
+// without changing anything
+func runDupesCommand(args []string) int {
+	fs := flag.NewFlagSet("dupes", flag.ContinueOnError)
+	keep := fs.String("keep", dupes.KeepOldest, "Copy to keep in each group (oldest, newest, shortest_path, preferred)")
+	prefer := fs.String("prefer", "", "Comma-separated directories whose copies are kept with --keep preferred")
+	minSize := fs.String("min-size", "", "Ignore files smaller than this size (e.g. 1MB)")
+	logFile := fs.String("log", "", "Path to log file")
+	logLevel := fs.String("log-level", "", "Log level (DEBUG, INFO, WARN, ERROR, FATAL)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: dirclean dupes [--keep policy] [--prefer dirs] [--min-size size] <path>...")
+		return 2
+	}
+
+	switch *keep {
+	case dupes.KeepOldest, dupes.KeepNewest, dupes.KeepShortestPath, dupes.KeepPreferred:
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid --keep: %s\n", *keep)
+		return 2
+	}
+	var preferred []string
+	for _, dir := range strings.Split(*prefer, ",") {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			expanded, err := config.ExpandPath(dir)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid --prefer: %v\n", err)
+				return 2
+			}
+			preferred = append(preferred, filepath.Clean(expanded))
+		}
+	}
+	if *keep == dupes.KeepPreferred && len(preferred) == 0 {
+		fmt.Fprintln(os.Stderr, "--keep preferred needs --prefer")
+		return 2
+	}
+	var minBytes int64
+	if *minSize != "" {
+		size, err := config.ParseFileSize(*minSize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --min-size: %v\n", err)
+			return 2
+		}
+		minBytes = size.ToBytes()
+	}
+
+	if *logFile != "" {
+		if err := logging.InitLogging(*logFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	if *logLevel != "" {
+		logging.SetLogLevel(*logLevel)
+	}
+
+	var files []dupes.File
+	for _, root := range fs.Args() {
+		expanded, err := config.ExpandPath(root)
+		if err != nil {
+			logging.LogMessage("ERROR", fmt.Sprintf("Error expanding path %s: %v", root, err))
+			return 1
+		}
+		err = filepath.Walk(expanded, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				logging.LogMessage("WARN", fmt.Sprintf("Error accessing path %s: %v", path, err))
+				return nil
+			}
+			if info.Mode().IsRegular() && info.Size() >= minBytes {
+				files = append(files, dupes.NewFile(path, info))
+			}
+			return nil
+		})
+		if err != nil {
+			logging.LogMessage("ERROR", fmt.Sprintf("Error walking %s: %v", expanded, err))
+			return 1
+		}
+	}
+
+	groups := dupes.Find(files)
+	count, reclaimable := modes.PrintDuplicates(groups, *keep, preferred)
+	fmt.Printf("\nFound %d duplicate files in %d groups, %s reclaimable\n",
+		count, len(groups), fileutils.FormatSize(reclaimable))
+	return 0
+}
@@ -1,10 +1,15 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"os/user"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/arkag/dirclean/logging"
@@ -16,16 +21,70 @@ type FileSize struct {
 	Unit  string
 }
 
+// Config holds the settings of a rule or of the defaults block. Optional
+// booleans and numbers are pointers so that a rule can explicitly set false
+// or zero to override a default; nil means "not specified".
 type Config struct {
-	OlderThanDays       int       `yaml:"older_than_days"`
-	Paths               []string  `yaml:"paths"`
-	MinFileSize         *FileSize `yaml:"min_file_size,omitempty"`
-	MaxFileSize         *FileSize `yaml:"max_file_size,omitempty"`
-	Mode                string    `yaml:"mode,omitempty"`
-	LogLevel            string    `yaml:"log_level,omitempty"`
-	LogFile             string    `yaml:"log_file,omitempty"`
-	CleanBrokenSymlinks bool      `yaml:"clean_broken_symlinks,omitempty"`
-	CleanEmptyDirs      bool      `yaml:"clean_empty_dirs,omitempty"`
+	Name                string              `yaml:"name,omitempty" merge:"-"`
+	Kind                string              `yaml:"kind,omitempty" merge:"-"`
+	OlderThanDays       *int                `yaml:"older_than_days,omitempty" merge:"age"`
+	OlderThan           *Duration           `yaml:"older_than,omitempty" merge:"age"`
+	Paths               []string            `yaml:"paths" merge:"-"`
+	MinFileSize         *FileSize           `yaml:"min_file_size,omitempty"`
+	MaxFileSize         *FileSize           `yaml:"max_file_size,omitempty"`
+	Mode                string              `yaml:"mode,omitempty"`
+	LogLevel            string              `yaml:"log_level,omitempty"`
+	LogFile             string              `yaml:"log_file,omitempty"`
+	CleanBrokenSymlinks *bool               `yaml:"clean_broken_symlinks,omitempty"`
+	CleanEmptyDirs      *bool               `yaml:"clean_empty_dirs,omitempty"`
+	Exclude             []string            `yaml:"exclude,omitempty" merge:"append"`
+	Action              string              `yaml:"action,omitempty"`
+	QuarantineDir       string              `yaml:"quarantine_dir,omitempty"`
+	QuarantineDays      *int                `yaml:"quarantine_days,omitempty"`
+	Compression         string              `yaml:"compression,omitempty"`
+	ArchiveDir          string              `yaml:"archive_dir,omitempty"`
+	TargetFree          *Percent            `yaml:"target_free,omitempty"`
+	TargetFreeBytes     *FileSize           `yaml:"target_free_bytes,omitempty"`
+	TargetOrder         string              `yaml:"target_order,omitempty"`
+	MaxTotalSize        *FileSize           `yaml:"max_total_size,omitempty"`
+	KeepNewest          *int                `yaml:"keep_newest,omitempty"`
+	GroupBy             string              `yaml:"group_by,omitempty"`
+	GroupPattern        string              `yaml:"group_pattern,omitempty"`
+	Retention           *Retention          `yaml:"retention,omitempty"`
+	AgeSource           string              `yaml:"age_source,omitempty"`
+	DatePattern         string              `yaml:"date_pattern,omitempty"`
+	DateLayout          string              `yaml:"date_layout,omitempty"`
+	AgeBy               string              `yaml:"age_by,omitempty"`
+	Owner               []string            `yaml:"owner,omitempty"`
+	ExcludeOwner        []string            `yaml:"exclude_owner,omitempty" merge:"append"`
+	Group               []string            `yaml:"group,omitempty"`
+	UIDRange            string              `yaml:"uid_range,omitempty"`
+	Perm                string              `yaml:"perm,omitempty"`
+	ContentTypes        []string            `yaml:"content_types,omitempty"`
+	ExcludeContentTypes []string            `yaml:"exclude_content_types,omitempty" merge:"append"`
+	NameRegex           []Regexp            `yaml:"name_regex,omitempty"`
+	PathRegex           []Regexp            `yaml:"path_regex,omitempty"`
+	ExcludeNameRegex    []Regexp            `yaml:"exclude_name_regex,omitempty" merge:"append"`
+	ExcludePathRegex    []Regexp            `yaml:"exclude_path_regex,omitempty" merge:"append"`
+	OnlyGitIgnored      *bool               `yaml:"only_git_ignored,omitempty"`
+	ArtifactDirs        map[string][]string `yaml:"artifact_dirs,omitempty"`
+	Unit                string              `yaml:"unit,omitempty"`
+	MinDepth            *int                `yaml:"min_depth,omitempty"`
+	MaxDepth            *int                `yaml:"max_depth,omitempty"`
+	Dedupe              string              `yaml:"dedupe,omitempty"`
+	DedupeKeep          string              `yaml:"dedupe_keep,omitempty"`
+	DedupePrefer        []string            `yaml:"dedupe_prefer,omitempty"`
+}
+
+// Retention is a grandfather-father-son rotation: for each period, the
+// newest file of that many of the most recent calendar days, weeks, months
+// or years is kept
+type Retention struct {
+	Daily   *int   `yaml:"daily,omitempty"`
+	Weekly  *int   `yaml:"weekly,omitempty"`
+	Monthly *int   `yaml:"monthly,omitempty"`
+	Yearly  *int   `yaml:"yearly,omitempty"`
+	Date    string `yaml:"date,omitempty"`
 }
 
 type GlobalConfig struct {
@@ -34,24 +93,53 @@ type GlobalConfig struct {
 }
 
 // UnmarshalYAML implements custom unmarshaling for FileSize
-func (f *FileSize) UnmarshalYAML(unmarshal func(interface{}) error) error {
+func (f *FileSize) UnmarshalYAML(value *yaml.Node) error {
 	var sizeStr string
-	if err := unmarshal(&sizeStr); err != nil {
+	if err := value.Decode(&sizeStr); err != nil {
 		return err
 	}
 
+	size, err := ParseFileSize(sizeStr)
+	if err != nil {
+		// Returned as a TypeError so decoding continues and reports the line
+		return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %d: %v", value.Line, err)}}
+	}
+	*f = size
+	return nil
+}
+
+// ParseFileSize parses sizes such as "100MB", "1.5GB" or a plain byte count
+func ParseFileSize(sizeStr string) (FileSize, error) {
 	sizeStr = strings.TrimSpace(strings.ToUpper(sizeStr))
+
+	// A plain number is a size in bytes, which also allows an explicit 0
+	if bytes, err := strconv.ParseFloat(sizeStr, 64); err == nil {
+		if bytes < 0 {
+			return FileSize{}, fmt.Errorf("invalid file size: %s must not be negative", sizeStr)
+		}
+		return FileSize{Value: bytes, Unit: "B"}, nil
+	}
+
 	var value float64
 	var unit string
+	if _, err := fmt.Sscanf(sizeStr, "%f%s", &value, &unit); err != nil {
+		return FileSize{}, fmt.Errorf("invalid file size format: %s", sizeStr)
+	}
+	if value < 0 {
+		return FileSize{}, fmt.Errorf("invalid file size: %s must not be negative", sizeStr)
+	}
 
-	_, err := fmt.Sscanf(sizeStr, "%f%s", &value, &unit)
-	if err != nil {
-		return fmt.Errorf("invalid file size format: %s", sizeStr)
+	switch unit {
+	case "B", "KB", "MB", "GB", "TB":
+	default:
+		return FileSize{}, fmt.Errorf("invalid file size unit %q in %s (use B, KB, MB, GB or TB)", unit, sizeStr)
 	}
+	return FileSize{Value: value, Unit: unit}, nil
+}
 
-	f.Value = value
-	f.Unit = unit
-	return nil
+// MarshalYAML writes FileSize back in the form it is configured in
+func (f FileSize) MarshalYAML() (interface{}, error) {
+	return strconv.FormatFloat(f.Value, 'f', -1, 64) + f.Unit, nil
 }
 
 // ToBytes converts FileSize to bytes
@@ -72,6 +160,29 @@ func (fs *FileSize) ToBytes() int64 {
 	return int64(fs.Value * float64(multiplier))
 }
 
+// Percent is a percentage written as "20%" or 20
+type Percent float64
+
+// UnmarshalYAML implements custom unmarshaling for Percent
+func (p *Percent) UnmarshalYAML(value *yaml.Node) error {
+	var percentStr string
+	if err := value.Decode(&percentStr); err != nil {
+		return err
+	}
+
+	percent, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(percentStr), "%")), 64)
+	if err != nil {
+		return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %d: invalid percentage: %s", value.Line, percentStr)}}
+	}
+	*p = Percent(percent)
+	return nil
+}
+
+// MarshalYAML writes Percent with a trailing "%"
+func (p Percent) MarshalYAML() (interface{}, error) {
+	return strconv.FormatFloat(float64(p), 'f', -1, 64) + "%", nil
+}
+
 // GetExampleConfigPath returns the OS-specific path for the example config
 func GetExampleConfigPath() string {
 	switch runtime.GOOS {
@@ -110,19 +221,22 @@ func getDefaultConfigPath() string {
 	}
 }
 
+// ResolveConfigPath maps the default "config.yaml" flag value to the
+// OS-specific system config location and returns any other path unchanged
+func ResolveConfigPath(configFile string) string {
+	if configFile == "config.yaml" {
+		return getDefaultConfigPath()
+	}
+	return configFile
+}
+
 // LoadConfig attempts to load the config file from the specified path or default location
 func LoadConfig(configFile string) GlobalConfig {
-	var err error
-	var f *os.File
-
 	// If no config file is specified, use the default path
-	if configFile == "config.yaml" {
-		configFile = getDefaultConfigPath()
-	}
+	configFile = ResolveConfigPath(configFile)
 
-	// Try to open the config file
-	f, err = os.Open(configFile)
-	if err != nil {
+	// Make sure the config file exists
+	if _, err := os.Stat(configFile); err != nil {
 		examplePath := GetExampleConfigPath()
 		logging.LogMessage("FATAL", fmt.Sprintf(
 			"Could not find config file at %s\n"+
@@ -132,47 +246,173 @@ func LoadConfig(configFile string) GlobalConfig {
 			configFile, examplePath, configFile, examplePath, configFile))
 		os.Exit(1)
 	}
-	defer f.Close()
 
-	var globalConfig GlobalConfig
-	decoder := yaml.NewDecoder(f)
-	if err := decoder.Decode(&globalConfig); err != nil {
-		logging.LogMessage("FATAL", fmt.Sprintf("Error decoding YAML: %v", err))
+	globalConfig, problems, err := ReadConfig(configFile)
+	if err != nil {
+		logging.LogMessage("FATAL", err.Error())
 		os.Exit(1)
 	}
 
+	failed := false
+	for _, problem := range problems {
+		if problem.Severity == SeverityError {
+			failed = true
+			logging.LogMessage("ERROR", fmt.Sprintf("%s: %s", configFile, problem))
+		} else {
+			logging.LogMessage("WARN", fmt.Sprintf("%s: %s", configFile, problem))
+		}
+	}
+	if failed {
+		logging.LogMessage("FATAL", fmt.Sprintf("Invalid config file %s, run 'dirclean config validate %s' for details",
+			configFile, configFile))
+		os.Exit(1)
+	}
+
+	logging.LogMessage("DEBUG", fmt.Sprintf("Loaded config: %+v", globalConfig))
+	return globalConfig
+}
+
+// ReadConfig parses a config file, expands paths, merges the defaults into
+// every rule and validates the result. Problems with individual settings are
+// collected and returned together instead of stopping at the first one; the
+// error is only set when the file cannot be read or is not valid YAML.
+func ReadConfig(configFile string) (GlobalConfig, []Problem, error) {
+	var globalConfig GlobalConfig
+
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return globalConfig, nil, fmt.Errorf("error reading config file: %v", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return globalConfig, nil, fmt.Errorf("error decoding YAML: %v", err)
+	}
+
+	problems := checkUnknownKeys(documentContent(&root), reflect.TypeOf(globalConfig), "")
+	if err := root.Decode(&globalConfig); err != nil {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return globalConfig, nil, fmt.Errorf("error decoding YAML: %v", err)
+		}
+		for _, msg := range typeErr.Errors {
+			problems = append(problems, problemFromYAML(msg))
+		}
+	}
+	pos := newPositions(&root)
+
+	// Expand ~ and environment variables before defaults are merged into rules
+	if err := expandConfigPaths(&globalConfig.Defaults); err != nil {
+		problems = append(problems, Problem{Line: pos.defaultsLine(), Severity: SeverityError,
+			Message: fmt.Sprintf("defaults: %v", err)})
+	}
+	for i := range globalConfig.Rules {
+		if err := expandConfigPaths(&globalConfig.Rules[i]); err != nil {
+			problems = append(problems, Problem{Line: pos.ruleLine(i), Severity: SeverityError,
+				Message: fmt.Sprintf("rule %d: %v", i+1, err)})
+		}
+	}
+
 	logging.LogMessage("DEBUG", fmt.Sprintf("Loaded defaults: %+v", globalConfig.Defaults))
 
 	// Merge defaults with each rule
 	for i := range globalConfig.Rules {
 		logging.LogMessage("DEBUG", fmt.Sprintf("Before merge - Rule %d: %+v", i, globalConfig.Rules[i]))
+		mergeDefaults(&globalConfig.Rules[i], globalConfig.Defaults)
+		if globalConfig.Rules[i].Name == "" {
+			globalConfig.Rules[i].Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		logging.LogMessage("DEBUG", fmt.Sprintf("After merge - Rule %d: %+v", i, globalConfig.Rules[i]))
+	}
+
+	problems = append(problems, validateGlobalConfig(globalConfig, pos)...)
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Line < problems[j].Line
+	})
+	return globalConfig, problems, nil
+}
 
-		if globalConfig.Rules[i].OlderThanDays == 0 {
-			globalConfig.Rules[i].OlderThanDays = globalConfig.Defaults.OlderThanDays
+// ExpandPath expands a leading ~ or ~user to the user's home directory and
+// replaces $VAR and ${VAR} references with their environment values. "$$"
+// produces a literal "$". Referencing an unset variable is an error.
+func ExpandPath(path string) (string, error) {
+	var missing []string
+	expanded := os.Expand(path, func(name string) string {
+		if name == "$" {
+			return "$"
 		}
-		if globalConfig.Rules[i].Mode == "" {
-			globalConfig.Rules[i].Mode = globalConfig.Defaults.Mode
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
 		}
-		if globalConfig.Rules[i].LogLevel == "" {
-			globalConfig.Rules[i].LogLevel = globalConfig.Defaults.LogLevel
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s referenced in %s is not set",
+			strings.Join(missing, ", "), path)
+	}
+
+	if !strings.HasPrefix(expanded, "~") {
+		return expanded, nil
+	}
+
+	// Split "~user/rest" into the user name and the remainder
+	name, rest := expanded[1:], ""
+	if i := strings.IndexAny(name, `/\`); i >= 0 {
+		name, rest = name[:i], name[i:]
+	}
+
+	var home string
+	if name == "" {
+		dir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("cannot expand %s: %v", path, err)
 		}
-		if globalConfig.Rules[i].LogFile == "" {
-			globalConfig.Rules[i].LogFile = globalConfig.Defaults.LogFile
+		home = dir
+	} else {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return "", fmt.Errorf("cannot expand %s: %v", path, err)
 		}
-		// Change this to check explicitly for false
-		if !globalConfig.Rules[i].CleanBrokenSymlinks {
-			globalConfig.Rules[i].CleanBrokenSymlinks = globalConfig.Defaults.CleanBrokenSymlinks
+		home = u.HomeDir
+	}
+	return home + rest, nil
+}
+
+// expandConfigPaths applies ExpandPath to every path-valued field of a config
+func expandConfigPaths(config *Config) error {
+	var err error
+	for i := range config.Paths {
+		if config.Paths[i], err = ExpandPath(config.Paths[i]); err != nil {
+			return err
 		}
-		// Add the new field
-		if !globalConfig.Rules[i].CleanEmptyDirs {
-			globalConfig.Rules[i].CleanEmptyDirs = globalConfig.Defaults.CleanEmptyDirs
+	}
+	for i := range config.Exclude {
+		if config.Exclude[i], err = ExpandPath(config.Exclude[i]); err != nil {
+			return err
 		}
-
-		logging.LogMessage("DEBUG", fmt.Sprintf("After merge - Rule %d: %+v", i, globalConfig.Rules[i]))
 	}
-
-	logging.LogMessage("DEBUG", fmt.Sprintf("Loaded config: %+v", globalConfig))
-	return globalConfig
+	if config.LogFile != "" {
+		if config.LogFile, err = ExpandPath(config.LogFile); err != nil {
+			return err
+		}
+	}
+	if config.QuarantineDir != "" {
+		if config.QuarantineDir, err = ExpandPath(config.QuarantineDir); err != nil {
+			return err
+		}
+	}
+	for i := range config.DedupePrefer {
+		if config.DedupePrefer[i], err = ExpandPath(config.DedupePrefer[i]); err != nil {
+			return err
+		}
+	}
+	if config.ArchiveDir != "" {
+		if config.ArchiveDir, err = ExpandPath(config.ArchiveDir); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // MergeWithFlags merges CLI flags with config values
@@ -203,25 +443,3 @@ type CLIFlags struct {
 	MinFileSize *FileSize
 	MaxFileSize *FileSize
 }
-
-// ValidateConfig validates the configuration values
-func ValidateConfig(config Config) error {
-	// Validate mode if specified
-	if config.Mode != "" && config.Mode != "analyze" && config.Mode != "dry-run" &&
-		config.Mode != "interactive" && config.Mode != "scheduled" {
-		return fmt.Errorf("invalid mode: %s", config.Mode)
-	}
-
-	// Validate log level if specified
-	if config.LogLevel != "" && config.LogLevel != "DEBUG" && config.LogLevel != "INFO" &&
-		config.LogLevel != "WARN" && config.LogLevel != "ERROR" && config.LogLevel != "FATAL" {
-		return fmt.Errorf("invalid log level: %s", config.LogLevel)
-	}
-
-	// Validate older_than_days
-	if config.OlderThanDays < 0 {
-		return fmt.Errorf("older_than_days must be non-negative, got: %d", config.OlderThanDays)
-	}
-
-	return nil
-}
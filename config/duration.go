@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is an age written as a sequence of numbers with units, such as
+// "6h", "90m", "2w" or "1d12h". Units are w (weeks), d (days), h, m and s.
+type Duration time.Duration
+
+// durationUnits lists the supported units, largest first
+var durationUnits = []struct {
+	name   string
+	length time.Duration
+}{
+	{"w", 7 * 24 * time.Hour},
+	{"d", 24 * time.Hour},
+	{"h", time.Hour},
+	{"m", time.Minute},
+	{"s", time.Second},
+}
+
+// UnmarshalYAML implements custom unmarshaling for Duration
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var durationStr string
+	if err := value.Decode(&durationStr); err != nil {
+		return err
+	}
+
+	duration, err := ParseDuration(durationStr)
+	if err != nil {
+		// Returned as a TypeError so decoding continues and reports the line
+		return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %d: %v", value.Line, err)}}
+	}
+	*d = duration
+	return nil
+}
+
+// MarshalYAML writes Duration in the same form it is configured in
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+// ParseDuration parses durations such as "6h", "1.5d" or "1d12h". A plain
+// "0" is accepted as no age.
+func ParseDuration(durationStr string) (Duration, error) {
+	s := strings.TrimSpace(durationStr)
+	if s == "0" {
+		return 0, nil
+	}
+	if s == "" {
+		return 0, fmt.Errorf("invalid duration: empty")
+	}
+
+	var total time.Duration
+	for s != "" {
+		end := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+		if end <= 0 {
+			return 0, fmt.Errorf("invalid duration %q (use e.g. 6h, 90m, 2w or 1d12h)", durationStr)
+		}
+		number, err := strconv.ParseFloat(s[:end], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q (use e.g. 6h, 90m, 2w or 1d12h)", durationStr)
+		}
+		s = s[end:]
+
+		unitEnd := strings.IndexFunc(s, func(r rune) bool { return r >= '0' && r <= '9' || r == '.' })
+		if unitEnd < 0 {
+			unitEnd = len(s)
+		}
+		unit := s[:unitEnd]
+		s = s[unitEnd:]
+
+		length := time.Duration(0)
+		for _, u := range durationUnits {
+			if u.name == unit {
+				length = u.length
+			}
+		}
+		if length == 0 {
+			return 0, fmt.Errorf("invalid duration unit %q in %q (use w, d, h, m or s)", unit, durationStr)
+		}
+		total += time.Duration(number * float64(length))
+	}
+	return Duration(total), nil
+}
+
+// String formats the duration with the largest units that fit, e.g. "1d12h"
+func (d Duration) String() string {
+	remaining := time.Duration(d)
+	if remaining <= 0 {
+		return "0"
+	}
+
+	var b strings.Builder
+	for _, u := range durationUnits {
+		if count := remaining / u.length; count > 0 {
+			fmt.Fprintf(&b, "%d%s", count, u.name)
+			remaining -= count * u.length
+		}
+	}
+	if b.Len() == 0 {
+		// Less than a second
+		return time.Duration(d).String()
+	}
+	return b.String()
+}
@@ -0,0 +1,284 @@
+package config
+
+import (
+	"bytes"
+	"reflect"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// mergeDefaults fills every setting the rule leaves unspecified with the value
+// from defaults. A field is unspecified when it holds its zero value, so nil
+// pointers are inherited while pointers to false or 0 are kept. Fields tagged
+// merge:"-" are never inherited and fields tagged merge:"append" get the
+// defaults' entries prepended to the rule's own. Any other merge tag names a
+// group of alternative settings: if the rule sets one of them, none of the
+// group is inherited, so a rule's older_than replaces the defaults'
+// older_than_days.
+func mergeDefaults(rule *Config, defaults Config) {
+	ruleValue := reflect.ValueOf(rule).Elem()
+	defaultsValue := reflect.ValueOf(defaults)
+	configType := ruleValue.Type()
+
+	setGroups := make(map[string]bool)
+	for i := 0; i < configType.NumField(); i++ {
+		if !ruleValue.Field(i).IsZero() {
+			setGroups[configType.Field(i).Tag.Get("merge")] = true
+		}
+	}
+
+	for i := 0; i < configType.NumField(); i++ {
+		field := ruleValue.Field(i)
+		inherited := defaultsValue.Field(i)
+
+		switch group := configType.Field(i).Tag.Get("merge"); group {
+		case "":
+		case "-":
+			continue
+		case "append":
+			if inherited.Len() > 0 {
+				merged := reflect.AppendSlice(reflect.MakeSlice(field.Type(), 0, inherited.Len()+field.Len()), inherited)
+				field.Set(reflect.AppendSlice(merged, field))
+			}
+			continue
+		default:
+			if setGroups[group] {
+				continue
+			}
+		}
+
+		if field.IsZero() {
+			field.Set(inherited)
+		}
+	}
+}
+
+// Resolved returns a copy of the config in which every unspecified optional
+// boolean is replaced by false and the depths of directory rules by their
+// defaults, so that the effective setting of each field is explicit when
+// displayed. Unset numbers are left nil since an absent keep_newest,
+// target_free or quarantine_days turns its feature off rather than setting
+// it to 0, and so are unset sizes, which mean "no limit", and unset
+// alternatives of a merge group, such as older_than next to older_than_days.
+func (c Config) Resolved() Config {
+	value := reflect.ValueOf(&c).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		if field.Kind() != reflect.Ptr || !field.IsNil() {
+			continue
+		}
+		switch value.Type().Field(i).Tag.Get("merge") {
+		case "", "-", "append":
+		default:
+			continue
+		}
+		if field.Type().Elem().Kind() == reflect.Bool {
+			field.Set(reflect.New(field.Type().Elem()))
+		}
+	}
+
+	if c.GetUnit() == "directory" {
+		minDepth, maxDepth := c.GetMinDepth(), c.GetMaxDepth()
+		c.MinDepth, c.MaxDepth = &minDepth, &maxDepth
+	}
+	return c
+}
+
+// EffectiveYAML renders every rule after defaults have been merged and unset
+// settings resolved, for --show-effective-config
+func EffectiveYAML(globalConfig GlobalConfig) ([]byte, error) {
+	var effective struct {
+		Rules []Config `yaml:"rules"`
+	}
+	for _, rule := range globalConfig.Rules {
+		effective.Rules = append(effective.Rules, rule.Resolved())
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(effective); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Value returns the value p points to, or the zero value of T when p is nil
+func Value[T any](p *T) T {
+	if p == nil {
+		var zero T
+		return zero
+	}
+	return *p
+}
+
+// GetOlderThanDays returns the configured age in days, or 0 when unset
+func (c Config) GetOlderThanDays() int {
+	return Value(c.OlderThanDays)
+}
+
+// GetOlderThan returns the age after which files are old, from older_than
+// or else older_than_days, or 0 when neither is set
+func (c Config) GetOlderThan() time.Duration {
+	if c.OlderThan != nil {
+		return time.Duration(*c.OlderThan)
+	}
+	return time.Duration(c.GetOlderThanDays()) * 24 * time.Hour
+}
+
+// ShouldCleanBrokenSymlinks reports whether broken symlinks are removed
+func (c Config) ShouldCleanBrokenSymlinks() bool {
+	return Value(c.CleanBrokenSymlinks)
+}
+
+// ShouldCleanEmptyDirs reports whether empty directories are removed
+func (c Config) ShouldCleanEmptyDirs() bool {
+	return Value(c.CleanEmptyDirs)
+}
+
+// ShouldOnlyCleanGitIgnored reports whether only untracked files ignored by
+// git are cleaned
+func (c Config) ShouldOnlyCleanGitIgnored() bool {
+	return Value(c.OnlyGitIgnored)
+}
+
+// GetKind returns what a rule cleans, "files" unless configured
+func (c Config) GetKind() string {
+	if c.Kind == "" {
+		return "files"
+	}
+	return c.Kind
+}
+
+// GetUnit returns what a rule ages and removes as one, "file" unless
+// configured
+func (c Config) GetUnit() string {
+	if c.Unit == "" {
+		return "file"
+	}
+	return c.Unit
+}
+
+// GetMinDepth returns the shallowest depth below a rule's path at which
+// directories are removed with unit directory, 1 unless configured
+func (c Config) GetMinDepth() int {
+	if c.MinDepth == nil {
+		return 1
+	}
+	return *c.MinDepth
+}
+
+// GetMaxDepth returns the deepest depth at which directories are removed
+// with unit directory, min_depth unless configured
+func (c Config) GetMaxDepth() int {
+	if c.MaxDepth == nil {
+		return c.GetMinDepth()
+	}
+	return *c.MaxDepth
+}
+
+// GetDedupeKeep returns which copy of duplicates is kept, "oldest" unless
+// configured
+func (c Config) GetDedupeKeep() string {
+	if c.DedupeKeep == "" {
+		return "oldest"
+	}
+	return c.DedupeKeep
+}
+
+// GetAction returns what happens to a candidate, "delete" unless configured
+func (c Config) GetAction() string {
+	if c.Action == "" {
+		return "delete"
+	}
+	return c.Action
+}
+
+// GetQuarantineDays returns how long quarantined files are kept, 0 for ever
+func (c Config) GetQuarantineDays() int {
+	return Value(c.QuarantineDays)
+}
+
+// GetCompression returns the format used by actions compress and archive,
+// gzip by default
+func (c Config) GetCompression() string {
+	if c.Compression == "" {
+		return "gzip"
+	}
+	return c.Compression
+}
+
+// HasTarget reports whether the rule cleans towards a free space target
+// rather than removing every eligible file
+func (c Config) HasTarget() bool {
+	return c.TargetFree != nil || c.TargetFreeBytes != nil
+}
+
+// GetTargetOrder returns which files a free space target removes first,
+// "oldest" unless configured
+func (c Config) GetTargetOrder() string {
+	if c.TargetOrder == "" {
+		return "oldest"
+	}
+	return c.TargetOrder
+}
+
+// HasQuota reports whether the rule keeps its files under max_total_size
+func (c Config) HasQuota() bool {
+	return c.MaxTotalSize != nil
+}
+
+// HasKeepNewest reports whether the rule keeps the newest files of each group
+func (c Config) HasKeepNewest() bool {
+	return c.KeepNewest != nil
+}
+
+// GetKeepNewest returns how many files of each group are kept
+func (c Config) GetKeepNewest() int {
+	return Value(c.KeepNewest)
+}
+
+// GetGroupBy returns how keep_newest groups files, "directory" unless
+// configured
+func (c Config) GetGroupBy() string {
+	if c.GroupBy == "" {
+		return "directory"
+	}
+	return c.GroupBy
+}
+
+// HasRetention reports whether the rule rotates files by calendar period
+func (c Config) HasRetention() bool {
+	return c.Retention != nil
+}
+
+// GetDate returns where retention takes a file's date from, "mtime" unless
+// configured
+func (r Retention) GetDate() string {
+	if r.Date == "" {
+		return "mtime"
+	}
+	return r.Date
+}
+
+// GetAgeSource returns where a file's age is taken from, "mtime" unless
+// configured
+func (c Config) GetAgeSource() string {
+	if c.AgeSource == "" {
+		return "mtime"
+	}
+	return c.AgeSource
+}
+
+// GetAgeBy returns which timestamp a file's age is measured by, "mtime"
+// unless configured
+func (c Config) GetAgeBy() string {
+	if c.AgeBy == "" {
+		return "mtime"
+	}
+	return c.AgeBy
+}
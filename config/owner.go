@@ -0,0 +1,113 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// PermFilter matches file permission bits in the style of find -perm: an
+// octal mode on its own must match exactly, "-mode" requires all of its bits
+// and "/mode" any of them, so "/002" selects world-writable files
+type PermFilter struct {
+	Bits  uint32
+	Match byte // '=', '-' or '/'
+}
+
+// ParsePerm parses a perm filter such as "644", "-0600" or "/002"
+func ParsePerm(perm string) (PermFilter, error) {
+	filter := PermFilter{Match: '='}
+	digits := strings.TrimSpace(perm)
+	if strings.HasPrefix(digits, "-") || strings.HasPrefix(digits, "/") {
+		filter.Match = digits[0]
+		digits = digits[1:]
+	}
+	bits, err := strconv.ParseUint(digits, 8, 32)
+	if err != nil || bits > 07777 {
+		return PermFilter{}, fmt.Errorf("invalid perm %q (use an octal mode such as 644, -600 or /002)", perm)
+	}
+	filter.Bits = uint32(bits)
+	return filter, nil
+}
+
+// Matches reports whether a file mode passes the filter
+func (p PermFilter) Matches(mode os.FileMode) bool {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 01000
+	}
+
+	switch p.Match {
+	case '-':
+		return bits&p.Bits == p.Bits
+	case '/':
+		return bits&p.Bits != 0
+	default:
+		return bits == p.Bits
+	}
+}
+
+// ParseUIDRange parses an inclusive range of user IDs such as "1000-1999"
+func ParseUIDRange(uidRange string) (min, max int, err error) {
+	low, high, ok := strings.Cut(strings.TrimSpace(uidRange), "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid uid_range %q (use e.g. 1000-1999)", uidRange)
+	}
+	if min, err = strconv.Atoi(strings.TrimSpace(low)); err != nil || min < 0 {
+		return 0, 0, fmt.Errorf("invalid uid_range %q (use e.g. 1000-1999)", uidRange)
+	}
+	if max, err = strconv.Atoi(strings.TrimSpace(high)); err != nil || max < min {
+		return 0, 0, fmt.Errorf("invalid uid_range %q (use e.g. 1000-1999)", uidRange)
+	}
+	return min, max, nil
+}
+
+// LookupUID resolves a user name or numeric user ID
+func LookupUID(name string) (int, error) {
+	if uid, err := strconv.Atoi(name); err == nil && uid >= 0 {
+		return uid, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, fmt.Errorf("unknown user: %s", name)
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return 0, fmt.Errorf("user %s has no numeric ID", name)
+	}
+	return uid, nil
+}
+
+// LookupGID resolves a group name or numeric group ID
+func LookupGID(name string) (int, error) {
+	if gid, err := strconv.Atoi(name); err == nil && gid >= 0 {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, fmt.Errorf("unknown group: %s", name)
+	}
+	gid, err := strconv.Atoi(g.Gid)
+	if err != nil {
+		return 0, fmt.Errorf("group %s has no numeric ID", name)
+	}
+	return gid, nil
+}
+
+func lookupUser(name string) error {
+	_, err := LookupUID(name)
+	return err
+}
+
+func lookupGroup(name string) error {
+	_, err := LookupGID(name)
+	return err
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Regexp is a regular expression that is compiled when the config is loaded
+type Regexp struct {
+	*regexp.Regexp
+}
+
+// UnmarshalYAML implements custom unmarshaling for Regexp
+func (r *Regexp) UnmarshalYAML(value *yaml.Node) error {
+	var pattern string
+	if err := value.Decode(&pattern); err != nil {
+		return err
+	}
+
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		// Returned as a TypeError so decoding continues and reports the line
+		return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %d: invalid regular expression %q: %v", value.Line, pattern, err)}}
+	}
+	r.Regexp = compiled
+	return nil
+}
+
+// MarshalYAML writes Regexp back as its source pattern
+func (r Regexp) MarshalYAML() (interface{}, error) {
+	if r.Regexp == nil {
+		return "", nil
+	}
+	return r.String(), nil
+}
+
+// MatchAny reports whether s matches at least one of the expressions
+func MatchAny(patterns []Regexp, s string) bool {
+	for _, pattern := range patterns {
+		if pattern.Regexp != nil && pattern.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
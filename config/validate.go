@@ -0,0 +1,666 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/arkag/dirclean/fileutils"
+	"github.com/arkag/dirclean/glob"
+	"gopkg.in/yaml.v3"
+)
+
+// Severity classifies a validation problem
+type Severity int
+
+const (
+	SeverityWarning Severity = iota // Suspicious but usable
+	SeverityError                   // The config must not be used
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// Problem is a single validation finding. Line is the line in the config
+// file the problem refers to, or 0 when it cannot be located.
+type Problem struct {
+	Line     int
+	Severity Severity
+	Message  string
+}
+
+func (p Problem) String() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s", p.Line, p.Severity, p.Message)
+	}
+	return fmt.Sprintf("%s: %s", p.Severity, p.Message)
+}
+
+var (
+	validModes        = []string{"analyze", "dry-run", "interactive", "scheduled"}
+	validLogLevels    = []string{"DEBUG", "INFO", "WARN", "ERROR", "FATAL"}
+	validActions      = []string{"delete", "trash", "quarantine", "compress", "archive"}
+	validCompressions = []string{"gzip", "zstd"}
+	validTargetOrders = []string{"oldest", "largest"}
+	validGroupBys     = []string{"directory", "prefix", "regex"}
+	validDates        = []string{"mtime", "filename"}
+	validAgeSources   = []string{"mtime", "filename"}
+	validAgeBys       = []string{"mtime", "atime", "ctime", "btime", "newest"}
+	validKinds        = []string{"files", "project_artifacts"}
+	validUnits        = []string{"file", "directory"}
+	validDedupes      = []string{"delete", "hardlink", "reflink", "report"}
+	validDedupeKeeps  = []string{"oldest", "newest", "shortest_path", "preferred"}
+)
+
+// fieldError is a validation error for the setting with the given YAML key
+type fieldError struct {
+	Field string
+	Err   error
+}
+
+// ValidateConfig validates the configuration values
+func ValidateConfig(config Config) error {
+	var errs []error
+	for _, fe := range validateRule(config) {
+		errs = append(errs, fe.Err)
+	}
+	return errors.Join(errs...)
+}
+
+// validateRule checks every setting of a merged rule and returns all errors
+func validateRule(config Config) []fieldError {
+	var errs []fieldError
+	add := func(field string, format string, args ...interface{}) {
+		errs = append(errs, fieldError{Field: field, Err: fmt.Errorf(format, args...)})
+	}
+
+	// Validate mode if specified
+	if config.Mode != "" && !contains(validModes, config.Mode) {
+		add("mode", "invalid mode: %s (expected one of %s)", config.Mode, strings.Join(validModes, ", "))
+	}
+
+	// Validate log level if specified
+	if config.LogLevel != "" && !contains(validLogLevels, config.LogLevel) {
+		add("log_level", "invalid log level: %s (expected one of %s)", config.LogLevel, strings.Join(validLogLevels, ", "))
+	}
+
+	// Validate action if specified
+	if config.Action != "" && !contains(validActions, config.Action) {
+		add("action", "invalid action: %s (expected one of %s)", config.Action, strings.Join(validActions, ", "))
+	}
+
+	// Validate rule kind. Artifact directories are removed as a whole, so
+	// only actions that work on directories apply.
+	if config.Kind != "" && !contains(validKinds, config.Kind) {
+		add("kind", "invalid kind: %s (expected one of %s)", config.Kind, strings.Join(validKinds, ", "))
+	}
+	if config.GetKind() == "project_artifacts" {
+		if action := config.GetAction(); action != "delete" && action != "trash" {
+			add("action", "kind project_artifacts only supports action delete or trash, got: %s", action)
+		}
+		if config.GetOlderThan() <= 0 {
+			add("older_than_days", "kind project_artifacts requires older_than or older_than_days")
+		}
+	}
+	for _, marker := range slices.Sorted(maps.Keys(config.ArtifactDirs)) {
+		if marker == "" || strings.ContainsAny(marker, `/\`) {
+			add("artifact_dirs", "invalid marker file name: %q", marker)
+		}
+		for _, dir := range config.ArtifactDirs[marker] {
+			if dir == "" || dir == "." || dir == ".." || strings.ContainsAny(dir, `/\`) {
+				add("artifact_dirs", "invalid artifact directory name %q for %s", dir, marker)
+			}
+		}
+	}
+
+	// Validate directory unit, which removes whole directories like
+	// project_artifacts does
+	if config.Unit != "" && !contains(validUnits, config.Unit) {
+		add("unit", "invalid unit: %s (expected one of %s)", config.Unit, strings.Join(validUnits, ", "))
+	}
+	if config.GetUnit() == "directory" {
+		if config.GetKind() != "files" {
+			add("unit", "unit directory cannot be combined with kind %s", config.GetKind())
+		}
+		if action := config.GetAction(); action != "delete" && action != "trash" {
+			add("action", "unit directory only supports action delete or trash, got: %s", action)
+		}
+		if config.GetOlderThan() <= 0 {
+			add("older_than_days", "unit directory requires older_than or older_than_days")
+		}
+	}
+	if config.GetMinDepth() < 1 {
+		add("min_depth", "min_depth must be at least 1, got: %d", config.GetMinDepth())
+	}
+	if config.GetMaxDepth() < config.GetMinDepth() {
+		add("max_depth", "max_depth must not be less than min_depth (%d), got: %d", config.GetMinDepth(), config.GetMaxDepth())
+	}
+
+	// Validate deduplication, which picks files on its own like retention
+	// and whole-directory removal do
+	if config.Dedupe != "" {
+		if !contains(validDedupes, config.Dedupe) {
+			add("dedupe", "invalid dedupe: %s (expected one of %s)", config.Dedupe, strings.Join(validDedupes, ", "))
+		}
+		if config.GetKind() != "files" {
+			add("dedupe", "dedupe cannot be combined with kind %s", config.GetKind())
+		}
+		if config.GetUnit() != "file" {
+			add("dedupe", "dedupe cannot be combined with unit %s", config.GetUnit())
+		}
+		if config.HasKeepNewest() || config.HasRetention() || config.HasTarget() || config.HasQuota() {
+			add("dedupe", "dedupe cannot be combined with keep_newest, retention, target_free or max_total_size")
+		}
+		// Duplicates are deleted or replaced by dedupe itself, never moved
+		// to the trash, quarantined, archived or compressed
+		if config.GetAction() != "delete" {
+			add("action", "dedupe cannot be combined with action %s", config.GetAction())
+		}
+	}
+	if config.DedupeKeep != "" && !contains(validDedupeKeeps, config.DedupeKeep) {
+		add("dedupe_keep", "invalid dedupe_keep: %s (expected one of %s)", config.DedupeKeep, strings.Join(validDedupeKeeps, ", "))
+	}
+	if config.DedupeKeep == "preferred" && len(config.DedupePrefer) == 0 {
+		add("dedupe_keep", "dedupe_keep preferred requires dedupe_prefer")
+	}
+	for _, dir := range config.DedupePrefer {
+		if !filepath.IsAbs(dir) {
+			add("dedupe_prefer", "dedupe_prefer must be absolute paths, got: %s", dir)
+		}
+	}
+
+	// Validate compression if specified
+	if config.Compression != "" && !contains(validCompressions, config.Compression) {
+		add("compression", "invalid compression: %s (expected one of %s)", config.Compression, strings.Join(validCompressions, ", "))
+	}
+
+	// Validate quarantine settings
+	if config.GetAction() == "quarantine" {
+		if config.QuarantineDir == "" {
+			add("action", "action quarantine requires quarantine_dir")
+		} else if !filepath.IsAbs(config.QuarantineDir) {
+			add("quarantine_dir", "quarantine_dir must be an absolute path, got: %s", config.QuarantineDir)
+		}
+		for _, path := range config.Paths {
+			if config.QuarantineDir != "" && pathsOverlap(path, config.QuarantineDir) {
+				add("quarantine_dir", "quarantine_dir %s overlaps path %s, so quarantined files would be cleaned again", config.QuarantineDir, path)
+			}
+		}
+	}
+	// Validate free space target
+	if config.TargetFree != nil && (*config.TargetFree < 0 || *config.TargetFree >= 100) {
+		add("target_free", "target_free must be between 0%% and 100%%, got: %v%%", float64(*config.TargetFree))
+	}
+	if config.TargetOrder != "" && !contains(validTargetOrders, config.TargetOrder) {
+		add("target_order", "invalid target_order: %s (expected one of %s)", config.TargetOrder, strings.Join(validTargetOrders, ", "))
+	}
+
+	// A free space target or a quota counts on selected files freeing their
+	// size, which moving them to the trash, compressing them or quarantining
+	// them on the same filesystem does not
+	if config.HasTarget() || config.HasQuota() {
+		switch action := config.GetAction(); action {
+		case "trash", "compress":
+			add("action", "target_free and max_total_size cannot be combined with action %s, which does not free the space they count on", action)
+		case "quarantine":
+			if config.QuarantineDir != "" && onSameFilesystem(config.QuarantineDir, config.Paths) {
+				add("action", "target_free and max_total_size cannot be combined with action quarantine when quarantine_dir %s is on the same filesystem as the rule's paths", config.QuarantineDir)
+			}
+		}
+	}
+
+	// Validate retention
+	if config.GetKeepNewest() < 0 {
+		add("keep_newest", "keep_newest must be non-negative, got: %d", config.GetKeepNewest())
+	}
+	if config.GroupBy != "" && !contains(validGroupBys, config.GroupBy) {
+		add("group_by", "invalid group_by: %s (expected one of %s)", config.GroupBy, strings.Join(validGroupBys, ", "))
+	}
+	if config.GetGroupBy() == "regex" {
+		if config.GroupPattern == "" {
+			add("group_by", "group_by regex requires group_pattern")
+		} else if _, err := regexp.Compile(config.GroupPattern); err != nil {
+			add("group_pattern", "invalid group_pattern %s: %v", config.GroupPattern, err)
+		}
+	}
+
+	if retention := config.Retention; retention != nil {
+		periods := map[string]*int{"daily": retention.Daily, "weekly": retention.Weekly, "monthly": retention.Monthly, "yearly": retention.Yearly}
+		keeps := 0
+		for _, name := range []string{"daily", "weekly", "monthly", "yearly"} {
+			if count := Value(periods[name]); count < 0 {
+				add("retention", "retention %s must be non-negative, got: %d", name, count)
+			} else {
+				keeps += count
+			}
+		}
+		if keeps == 0 {
+			add("retention", "retention keeps no files, set at least one of daily, weekly, monthly or yearly")
+		}
+		if retention.Date != "" && !contains(validDates, retention.Date) {
+			add("retention", "invalid retention date: %s (expected one of %s)", retention.Date, strings.Join(validDates, ", "))
+		}
+	}
+
+	// Validate date parsing
+	if config.AgeSource != "" && !contains(validAgeSources, config.AgeSource) {
+		add("age_source", "invalid age_source: %s (expected one of %s)", config.AgeSource, strings.Join(validAgeSources, ", "))
+	}
+	if config.AgeBy != "" && !contains(validAgeBys, config.AgeBy) {
+		add("age_by", "invalid age_by: %s (expected one of %s)", config.AgeBy, strings.Join(validAgeBys, ", "))
+	}
+	if config.DatePattern != "" {
+		if _, err := regexp.Compile(config.DatePattern); err != nil {
+			add("date_pattern", "invalid date_pattern %s: %v", config.DatePattern, err)
+		}
+	} else if config.DateLayout != "" {
+		add("date_layout", "date_layout requires date_pattern to select the date in the file name")
+	}
+
+	// Validate owner and permission filters. Owner and group names are
+	// resolved on the host that runs the rule, see unknownOwners.
+	if config.UIDRange != "" {
+		if _, _, err := ParseUIDRange(config.UIDRange); err != nil {
+			add("uid_range", "%v", err)
+		}
+	}
+	if config.Perm != "" {
+		if _, err := ParsePerm(config.Perm); err != nil {
+			add("perm", "%v", err)
+		}
+	}
+
+	// Validate content types
+	for _, field := range []struct {
+		name     string
+		patterns []string
+	}{
+		{"content_types", config.ContentTypes},
+		{"exclude_content_types", config.ExcludeContentTypes},
+	} {
+		for _, pattern := range field.patterns {
+			if major, minor, ok := strings.Cut(pattern, "/"); !ok || major == "" || minor == "" || strings.Contains(minor, "/") {
+				add(field.name, "invalid content type %q (use e.g. application/zip or video/*)", pattern)
+			}
+		}
+	}
+
+	// Validate archive settings
+	if config.GetAction() == "archive" {
+		if config.ArchiveDir == "" {
+			add("action", "action archive requires archive_dir")
+		} else if !filepath.IsAbs(config.ArchiveDir) {
+			add("archive_dir", "archive_dir must be an absolute path, got: %s", config.ArchiveDir)
+		}
+		for _, path := range config.Paths {
+			if config.ArchiveDir != "" && pathsOverlap(path, config.ArchiveDir) {
+				add("archive_dir", "archive_dir %s overlaps path %s, so archives would be cleaned themselves", config.ArchiveDir, path)
+			}
+		}
+	}
+	if config.GetQuarantineDays() < 0 {
+		add("quarantine_days", "quarantine_days must be non-negative, got: %d", config.GetQuarantineDays())
+	}
+
+	// Validate older_than_days
+	if config.GetOlderThanDays() < 0 {
+		add("older_than_days", "older_than_days must be non-negative, got: %d", config.GetOlderThanDays())
+	}
+	if config.OlderThan != nil && config.OlderThanDays != nil {
+		add("older_than", "set either older_than or older_than_days, not both")
+	}
+	// Without an age, only retention, a free space target, a quota or dedupe
+	// select files. Other kinds and units report their own requirement.
+	if config.GetOlderThan() == 0 && config.GetKind() == "files" && config.GetUnit() == "file" &&
+		!config.HasKeepNewest() && !config.HasRetention() && !config.HasTarget() && !config.HasQuota() && config.Dedupe == "" {
+		add("older_than_days", "older_than or older_than_days is required unless keep_newest, retention, target_free, max_total_size or dedupe selects files")
+	}
+
+	// Validate size limits
+	if config.MinFileSize != nil && config.MaxFileSize != nil && config.MaxFileSize.ToBytes() > 0 &&
+		config.MinFileSize.ToBytes() > config.MaxFileSize.ToBytes() {
+		add("min_file_size", "min_file_size %s is larger than max_file_size %s",
+			formatFileSize(config.MinFileSize), formatFileSize(config.MaxFileSize))
+	}
+
+	// Validate exclude patterns
+	for _, pattern := range config.Exclude {
+		if _, err := glob.Compile(strings.TrimSuffix(filepath.ToSlash(pattern), "/")); err != nil {
+			add("exclude", "invalid exclude pattern %q: %v", pattern, err)
+		}
+	}
+
+	// Validate path patterns
+	for _, path := range config.Paths {
+		if _, err := glob.Compile(filepath.ToSlash(path)); err != nil {
+			add("paths", "invalid path %q: %v", path, err)
+		}
+	}
+
+	return errs
+}
+
+// onSameFilesystem reports whether dir, or its nearest existing parent, is
+// on the filesystem of one of paths. Paths that do not exist are left out.
+func onSameFilesystem(dir string, paths []string) bool {
+	device, ok := deviceOf(dir)
+	if !ok {
+		return false
+	}
+	for _, path := range paths {
+		if pathDevice, ok := deviceOf(filepath.FromSlash(glob.Base(filepath.ToSlash(path)))); ok && pathDevice == device {
+			return true
+		}
+	}
+	return false
+}
+
+// deviceOf returns the device of path or its nearest existing parent
+func deviceOf(path string) (uint64, bool) {
+	for {
+		if info, err := os.Stat(path); err == nil {
+			device, _, ok := fileutils.FileID(info)
+			return device, ok
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return 0, false
+		}
+		path = parent
+	}
+}
+
+// unknownOwners reports owner, exclude_owner and group names that do not
+// exist on this host. They may exist on the hosts the config is deployed
+// to, so they are only warnings; a rule whose names cannot be resolved at
+// run time is skipped.
+func unknownOwners(config Config) []fieldError {
+	var errs []fieldError
+	for _, field := range []struct {
+		name   string
+		values []string
+		lookup func(string) error
+	}{
+		{"owner", config.Owner, lookupUser},
+		{"exclude_owner", config.ExcludeOwner, lookupUser},
+		{"group", config.Group, lookupGroup},
+	} {
+		for _, value := range field.values {
+			if err := field.lookup(value); err != nil {
+				errs = append(errs, fieldError{field.name, fmt.Errorf("%v on this host", err)})
+			}
+		}
+	}
+	return errs
+}
+
+// validateGlobalConfig validates every merged rule and the relationships
+// between rules, locating each problem in the file through pos
+func validateGlobalConfig(globalConfig GlobalConfig, pos positions) []Problem {
+	var problems []Problem
+
+	if len(globalConfig.Defaults.Paths) > 0 {
+		problems = append(problems, Problem{Line: pos.defaultsKeyLine("paths"), Severity: SeverityWarning,
+			Message: "defaults: paths are ignored in defaults, set them on each rule"})
+	}
+	if len(globalConfig.Rules) == 0 {
+		problems = append(problems, Problem{Line: pos.rulesLine(), Severity: SeverityWarning,
+			Message: "no rules defined, nothing will be cleaned"})
+	}
+
+	names := make(map[string]int)
+	for i, rule := range globalConfig.Rules {
+		if first, ok := names[rule.Name]; ok {
+			problems = append(problems, Problem{Line: pos.settingLine(i, "name"), Severity: SeverityError,
+				Message: fmt.Sprintf("rule %d: name %q is already used by rule %d", i+1, rule.Name, first+1)})
+		} else {
+			names[rule.Name] = i
+		}
+		if len(rule.Paths) == 0 {
+			problems = append(problems, Problem{Line: pos.ruleLine(i), Severity: SeverityError,
+				Message: fmt.Sprintf("rule %d: paths must not be empty", i+1)})
+		}
+		for _, fe := range validateRule(rule) {
+			problems = append(problems, Problem{Line: pos.settingLine(i, fe.Field), Severity: SeverityError,
+				Message: fmt.Sprintf("rule %d: %v", i+1, fe.Err)})
+		}
+		for _, fe := range unknownOwners(rule) {
+			problems = append(problems, Problem{Line: pos.settingLine(i, fe.Field), Severity: SeverityWarning,
+				Message: fmt.Sprintf("rule %d: %v", i+1, fe.Err)})
+		}
+
+		// Report rules that select the same files as an earlier rule
+		for j := 0; j < i; j++ {
+			for _, path := range rule.Paths {
+				for _, other := range globalConfig.Rules[j].Paths {
+					if pathsOverlap(path, other) {
+						problems = append(problems, Problem{Line: pos.settingLine(i, "paths"), Severity: SeverityWarning,
+							Message: fmt.Sprintf("rule %d: path %s overlaps with %s in rule %d (line %d)",
+								i+1, path, other, j+1, pos.settingLine(j, "paths"))})
+					}
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// pathsOverlap reports whether two configured paths can select the same
+// files. Plain directories cover their whole tree; two glob patterns are
+// only considered overlapping when they are identical.
+func pathsOverlap(a, b string) bool {
+	a, b = filepath.ToSlash(filepath.Clean(a)), filepath.ToSlash(filepath.Clean(b))
+	if a == b {
+		return true
+	}
+
+	aGlob, bGlob := glob.HasMeta(a), glob.HasMeta(b)
+	switch {
+	case !aGlob && !bGlob:
+		return isWithin(a, b) || isWithin(b, a)
+	case aGlob && bGlob:
+		return false
+	case aGlob:
+		a, b = b, a
+	}
+
+	// a is a plain directory, b a pattern
+	if isWithin(glob.Base(b), a) {
+		return true
+	}
+	g, err := glob.Compile(b)
+	if err != nil {
+		return false
+	}
+	return g.Match(a) || g.MatchPrefix(a)
+}
+
+// isWithin reports whether path is dir or below it
+func isWithin(path, dir string) bool {
+	if path == dir {
+		return true
+	}
+	return strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/")
+}
+
+// positions locates settings of the parsed YAML document by line number
+type positions struct {
+	root     *yaml.Node
+	defaults *yaml.Node
+	rules    []*yaml.Node
+}
+
+func newPositions(document *yaml.Node) positions {
+	pos := positions{root: documentContent(document)}
+	pos.defaults = mappingValue(pos.root, "defaults")
+	if rules := mappingValue(pos.root, "rules"); rules != nil && rules.Kind == yaml.SequenceNode {
+		pos.rules = rules.Content
+	}
+	return pos
+}
+
+func (p positions) rulesLine() int {
+	if key := mappingKey(p.root, "rules"); key != nil {
+		return key.Line
+	}
+	return 0
+}
+
+func (p positions) defaultsLine() int {
+	if key := mappingKey(p.root, "defaults"); key != nil {
+		return key.Line
+	}
+	return 0
+}
+
+func (p positions) defaultsKeyLine(field string) int {
+	if key := mappingKey(p.defaults, field); key != nil {
+		return key.Line
+	}
+	return p.defaultsLine()
+}
+
+func (p positions) ruleLine(rule int) int {
+	if rule < len(p.rules) {
+		return p.rules[rule].Line
+	}
+	return 0
+}
+
+// settingLine returns the line a rule's setting is defined on: the rule's
+// own key if present, otherwise the key in defaults it was inherited from,
+// otherwise the start of the rule
+func (p positions) settingLine(rule int, field string) int {
+	if rule < len(p.rules) {
+		if key := mappingKey(p.rules[rule], field); key != nil {
+			return key.Line
+		}
+	}
+	if key := mappingKey(p.defaults, field); key != nil {
+		return key.Line
+	}
+	return p.ruleLine(rule)
+}
+
+// documentContent returns the top-level node of a parsed YAML document
+func documentContent(document *yaml.Node) *yaml.Node {
+	if document.Kind == yaml.DocumentNode && len(document.Content) > 0 {
+		return document.Content[0]
+	}
+	return document
+}
+
+func mappingKey(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i]
+		}
+	}
+	return nil
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+var unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+// checkUnknownKeys reports every mapping key in node that does not correspond
+// to a yaml-tagged field of t, recursing into nested structs and lists
+func checkUnknownKeys(node *yaml.Node, t reflect.Type, where string) []Problem {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if node == nil || reflect.PointerTo(t).Implements(unmarshalerType) {
+		return nil
+	}
+
+	var problems []Problem
+	switch t.Kind() {
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return nil
+		}
+		for i, item := range node.Content {
+			problems = append(problems, checkUnknownKeys(item, t.Elem(), fmt.Sprintf("%s %d", strings.TrimSuffix(where, "s"), i+1))...)
+		}
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		fields := make(map[string]reflect.Type)
+		var names []string
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			fields[name] = t.Field(i).Type
+			names = append(names, name)
+		}
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			fieldType, ok := fields[key.Value]
+			if !ok {
+				prefix := ""
+				if where != "" {
+					prefix = where + ": "
+				}
+				problems = append(problems, Problem{Line: key.Line, Severity: SeverityError,
+					Message: fmt.Sprintf("%sunknown key %q", prefix, key.Value)})
+				continue
+			}
+			nested := key.Value
+			if where != "" {
+				nested = where + " " + key.Value
+			}
+			problems = append(problems, checkUnknownKeys(node.Content[i+1], fieldType, nested)...)
+		}
+	}
+	return problems
+}
+
+// problemFromYAML converts a yaml.v3 type error message ("line N: ...")
+func problemFromYAML(msg string) Problem {
+	var line int
+	if _, err := fmt.Sscanf(msg, "line %d:", &line); err == nil {
+		msg = strings.TrimSpace(msg[strings.Index(msg, ":")+1:])
+	}
+	return Problem{Line: line, Severity: SeverityError, Message: msg}
+}
+
+func formatFileSize(size *FileSize) string {
+	out, _ := size.MarshalYAML()
+	return fmt.Sprint(out)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+// Package dupes finds files with identical contents and replaces copies
+// with links to a single one.
+package dupes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arkag/dirclean/fileutils"
+	"github.com/arkag/dirclean/logging"
+)
+
+// Policies choosing which copy of a group is kept
+const (
+	KeepOldest       = "oldest"
+	KeepNewest       = "newest"
+	KeepShortestPath = "shortest_path"
+	KeepPreferred    = "preferred"
+)
+
+// partialSize is how much of each file is hashed before files of the same
+// size are hashed completely
+const partialSize = 4096
+
+// File is a file considered for duplicate detection
+type File struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	device  uint64
+	inode   uint64
+	hasID   bool
+}
+
+// NewFile describes the file at path from its Lstat info
+func NewFile(path string, info os.FileInfo) File {
+	f := File{Path: path, Size: info.Size(), ModTime: info.ModTime()}
+	f.device, f.inode, f.hasID = fileutils.FileID(info)
+	return f
+}
+
+// Group is a set of files with identical contents
+type Group struct {
+	Size   int64
+	SHA256 string
+	Files  []File
+}
+
+// Reclaimable returns the bytes freed by keeping only one file of the group
+func (g Group) Reclaimable() int64 {
+	return g.Size * int64(len(g.Files)-1)
+}
+
+// Find groups files with identical contents. Files are first grouped by
+// size, then by a hash of their first bytes and only then by a SHA-256 of
+// their whole contents, so most files are never read completely. Empty
+// files and additional hard links to the same file are left out. Groups are
+// ordered by reclaimable bytes, largest first.
+func Find(files []File) []Group {
+	bySize := make(map[int64][]File)
+	seen := make(map[[2]uint64]bool)
+	for _, f := range files {
+		if f.Size == 0 {
+			continue
+		}
+		if f.hasID {
+			id := [2]uint64{f.device, f.inode}
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+		}
+		bySize[f.Size] = append(bySize[f.Size], f)
+	}
+
+	var groups []Group
+	for size, sameSize := range bySize {
+		if len(sameSize) < 2 {
+			continue
+		}
+		for _, samePartial := range groupByHash(sameSize, partialSize) {
+			if size <= partialSize {
+				groups = append(groups, newGroup(size, samePartial.hash, samePartial.files))
+				continue
+			}
+			for _, sameFull := range groupByHash(samePartial.files, -1) {
+				groups = append(groups, newGroup(size, sameFull.hash, sameFull.files))
+			}
+		}
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Reclaimable() != groups[j].Reclaimable() {
+			return groups[i].Reclaimable() > groups[j].Reclaimable()
+		}
+		return groups[i].Files[0].Path < groups[j].Files[0].Path
+	})
+	return groups
+}
+
+func newGroup(size int64, hash string, files []File) Group {
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return Group{Size: size, SHA256: hash, Files: files}
+}
+
+type hashed struct {
+	hash  string
+	files []File
+}
+
+// groupByHash hashes the first limit bytes of each file, or all of it for a
+// negative limit, and returns the sets of two or more files with equal
+// hashes. Files that cannot be read are left out.
+func groupByHash(files []File, limit int64) []hashed {
+	byHash := make(map[string][]File)
+	var order []string
+	for _, f := range files {
+		hash, err := hashFile(f.Path, limit)
+		if err != nil {
+			logging.LogMessage("ERROR", fmt.Sprintf("Error hashing %s: %v", f.Path, err))
+			continue
+		}
+		if _, ok := byHash[hash]; !ok {
+			order = append(order, hash)
+		}
+		byHash[hash] = append(byHash[hash], f)
+	}
+
+	var result []hashed
+	for _, hash := range order {
+		if len(byHash[hash]) > 1 {
+			result = append(result, hashed{hash, byHash[hash]})
+		}
+	}
+	return result
+}
+
+func hashFile(path string, limit int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if limit >= 0 {
+		r = io.LimitReader(f, limit)
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Split picks the file of the group to keep according to policy and returns
+// it with the duplicates. With KeepPreferred, a file below the first of the
+// preferred directories that holds a copy is kept, falling back to the
+// oldest. Ties are broken by path.
+func (g Group) Split(policy string, preferred []string) (File, []File) {
+	files := append([]File(nil), g.Files...)
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		switch policy {
+		case KeepNewest:
+			if !a.ModTime.Equal(b.ModTime) {
+				return a.ModTime.After(b.ModTime)
+			}
+		case KeepShortestPath:
+			if len(a.Path) != len(b.Path) {
+				return len(a.Path) < len(b.Path)
+			}
+		case KeepPreferred:
+			if ra, rb := preferenceRank(a.Path, preferred), preferenceRank(b.Path, preferred); ra != rb {
+				return ra < rb
+			}
+			fallthrough
+		default:
+			if !a.ModTime.Equal(b.ModTime) {
+				return a.ModTime.Before(b.ModTime)
+			}
+		}
+		return a.Path < b.Path
+	})
+	return files[0], files[1:]
+}
+
+// preferenceRank returns the index of the first preferred directory
+// containing path, or len(preferred) if none does
+func preferenceRank(path string, preferred []string) int {
+	for i, dir := range preferred {
+		dir = filepath.Clean(dir)
+		if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return i
+		}
+	}
+	return len(preferred)
+}
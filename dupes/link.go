@@ -0,0 +1,118 @@
+package dupes
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// SameContents reports whether two files have identical contents. It is
+// checked right before a duplicate is removed or replaced, since either
+// file may have changed after it was hashed. Both must be regular files
+// and not the same file, so a link is never mistaken for a copy of its
+// target.
+func SameContents(a, b string) (bool, error) {
+	for _, path := range []string{a, b} {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return false, err
+		}
+		if !info.Mode().IsRegular() {
+			return false, fmt.Errorf("%s is not a regular file", path)
+		}
+	}
+
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	infoA, err := fa.Stat()
+	if err != nil {
+		return false, err
+	}
+	infoB, err := fb.Stat()
+	if err != nil {
+		return false, err
+	}
+	if os.SameFile(infoA, infoB) {
+		return false, fmt.Errorf("%s and %s are the same file", a, b)
+	}
+
+	ra, rb := bufio.NewReader(fa), bufio.NewReader(fb)
+	bufA, bufB := make([]byte, 64*1024), make([]byte, 64*1024)
+	for {
+		na, errA := io.ReadFull(ra, bufA)
+		nb, errB := io.ReadFull(rb, bufB)
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return errB == io.EOF || errB == io.ErrUnexpectedEOF, nil
+		}
+		if errA != nil {
+			return false, errA
+		}
+		if errB != nil {
+			return false, errB
+		}
+	}
+}
+
+// Hardlink replaces dup with a hard link to keep. Both must be on the same
+// filesystem. The link is created under a temporary name and renamed over
+// dup, so dup is never missing.
+func Hardlink(keep, dup string) error {
+	return replace(dup, func(tmp string) error {
+		return os.Link(keep, tmp)
+	})
+}
+
+// Reflink replaces dup with a copy-on-write clone of keep that shares its
+// data blocks, keeping dup's permissions and modification time. It needs a
+// filesystem with reflink support such as Btrfs, XFS or APFS.
+func Reflink(keep, dup string) error {
+	info, err := os.Lstat(dup)
+	if err != nil {
+		return err
+	}
+	return replace(dup, func(tmp string) error {
+		if err := cloneFile(keep, tmp); err != nil {
+			return err
+		}
+		if err := os.Chmod(tmp, info.Mode().Perm()); err != nil {
+			return err
+		}
+		return os.Chtimes(tmp, info.ModTime(), info.ModTime())
+	})
+}
+
+// replace creates a file with create under a free temporary name next to
+// path and renames it over path
+func replace(path string, create func(tmp string) error) error {
+	dir, base := filepath.Split(path)
+	for i := 0; ; i++ {
+		tmp := filepath.Join(dir, fmt.Sprintf(".%s.dirclean-%d", base, i))
+		if _, err := os.Lstat(tmp); err == nil {
+			continue
+		}
+		if err := create(tmp); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		return nil
+	}
+}
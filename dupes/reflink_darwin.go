@@ -0,0 +1,8 @@
+package dupes
+
+import "golang.org/x/sys/unix"
+
+// cloneFile creates dst as an APFS clone of src
+func cloneFile(src, dst string) error {
+	return unix.Clonefile(src, dst, unix.CLONE_NOFOLLOW)
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package dupes
+
+import "errors"
+
+func cloneFile(src, dst string) error {
+	return errors.New("reflinks are not supported on this platform")
+}
@@ -0,0 +1,164 @@
+package fileutils
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrNotSmaller is returned by CompressFile when the compressed copy would
+// not be smaller than the original, which is then kept
+var ErrNotSmaller = errors.New("compressed copy is not smaller than the original")
+
+// compressedExtensions lists extensions of files that are already compressed
+// and would not shrink further
+var compressedExtensions = map[string]bool{
+	".gz": true, ".tgz": true, ".zst": true, ".zstd": true, ".xz": true, ".txz": true,
+	".bz2": true, ".tbz2": true, ".lz4": true, ".lzma": true, ".br": true, ".z": true,
+	".zip": true, ".7z": true, ".rar": true,
+}
+
+// IsCompressed reports whether path has the extension of a compressed file
+func IsCompressed(path string) bool {
+	return compressedExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// CompressionExtension returns the extension added by a compression format
+func CompressionExtension(format string) string {
+	if format == "zstd" {
+		return ".zst"
+	}
+	return ".gz"
+}
+
+// CompressFile replaces path with a gzip or zstd compressed copy named
+// path+".gz" or path+".zst", keeping the original's permissions, owner and
+// modification time. It returns the new path and the bytes saved. If the
+// compressed copy is not smaller, it is removed and ErrNotSmaller returned.
+func CompressFile(path string, format string) (string, int64, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", 0, err
+	}
+	if !info.Mode().IsRegular() {
+		return "", 0, fmt.Errorf("not a regular file")
+	}
+
+	target := path + CompressionExtension(format)
+	if _, err := os.Lstat(target); err == nil {
+		return "", 0, fmt.Errorf("%s already exists", target)
+	}
+
+	// Compress into a temporary file next to the target so a failure never
+	// leaves a truncated archive under the final name
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(target)+".tmp-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("error creating compressed file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := compressTo(tmp, path, format); err != nil {
+		tmp.Close()
+		return "", 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, fmt.Errorf("error writing compressed file: %v", err)
+	}
+	compressedInfo, err := os.Stat(tmp.Name())
+	if err != nil {
+		return "", 0, err
+	}
+	if compressedInfo.Size() >= info.Size() {
+		return "", 0, ErrNotSmaller
+	}
+
+	// The owner is set first, since changing it clears the setuid and
+	// setgid bits
+	if uid, gid, ok := FileOwner(info); ok {
+		// Only possible as root; the file then keeps the current user as owner
+		os.Lchown(tmp.Name(), uid, gid)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return "", 0, err
+	}
+	if err := os.Chtimes(tmp.Name(), time.Now(), info.ModTime()); err != nil {
+		return "", 0, err
+	}
+
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", 0, fmt.Errorf("error renaming compressed file: %v", err)
+	}
+	if err := os.Remove(path); err != nil {
+		return target, 0, fmt.Errorf("compressed to %s but could not remove original: %v", target, err)
+	}
+	return target, info.Size() - compressedInfo.Size(), nil
+}
+
+func compressTo(w io.Writer, path string, format string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	encoder, err := NewCompressWriter(w, format)
+	if err != nil {
+		return err
+	}
+	if gz, ok := encoder.(*gzip.Writer); ok {
+		gz.Name = filepath.Base(path)
+		if info, err := src.Stat(); err == nil {
+			gz.ModTime = info.ModTime()
+		}
+	}
+
+	if _, err := io.Copy(encoder, src); err != nil {
+		encoder.Close()
+		return fmt.Errorf("error compressing %s: %v", path, err)
+	}
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("error compressing %s: %v", path, err)
+	}
+	return nil
+}
+
+// NewCompressWriter returns a writer that compresses to w in the given
+// format. Closing it flushes the compressed stream but does not close w.
+func NewCompressWriter(w io.Writer, format string) (io.WriteCloser, error) {
+	switch format {
+	case "zstd":
+		encoder, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, fmt.Errorf("error creating zstd writer: %v", err)
+		}
+		return encoder, nil
+	case "gzip", "":
+		return gzip.NewWriter(w), nil
+	default:
+		return nil, fmt.Errorf("unknown compression format: %s", format)
+	}
+}
+
+// NewDecompressReader returns a reader that decompresses r from the given
+// format
+func NewDecompressReader(r io.Reader, format string) (io.ReadCloser, error) {
+	switch format {
+	case "zstd":
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("error creating zstd reader: %v", err)
+		}
+		return decoder.IOReadCloser(), nil
+	case "gzip", "":
+		return gzip.NewReader(r)
+	default:
+		return nil, fmt.Errorf("unknown compression format: %s", format)
+	}
+}
@@ -0,0 +1,93 @@
+package fileutils
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// sniffLen is how much of a file is read to detect its type. ISO 9660
+// images carry their signature after 32 KiB of system area.
+const sniffLen = 32774
+
+// signature is a magic byte sequence at a fixed offset
+type signature struct {
+	offset      int
+	magic       []byte
+	contentType string
+}
+
+// signatures covers formats net/http does not detect, checked first
+var signatures = []signature{
+	{0, []byte{0x28, 0xB5, 0x2F, 0xFD}, "application/zstd"},
+	{0, []byte{0xFD, '7', 'z', 'X', 'Z', 0x00}, "application/x-xz"},
+	{0, []byte("BZh"), "application/x-bzip2"},
+	{0, []byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C}, "application/x-7z-compressed"},
+	{257, []byte("ustar"), "application/x-tar"},
+	{32769, []byte("CD001"), "application/x-iso9660-image"},
+	{0, []byte("SQLite format 3\x00"), "application/vnd.sqlite3"},
+	{0, []byte("\x1A\x45\xDF\xA3"), "video/x-matroska"},
+	{4, []byte("ftypheic"), "image/heic"},
+	{4, []byte("ftypqt"), "video/quicktime"},
+}
+
+// DetectContentType sniffs the type of a file from its first bytes, adding
+// archive, disk image, database and core dump formats to those detected by
+// net/http. Parameters such as charset are dropped.
+func DetectContentType(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	header := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return detectContentType(header[:n]), nil
+}
+
+func detectContentType(header []byte) string {
+	for _, sig := range signatures {
+		if len(header) >= sig.offset+len(sig.magic) && bytes.Equal(header[sig.offset:sig.offset+len(sig.magic)], sig.magic) {
+			return sig.contentType
+		}
+	}
+
+	// ELF files are executables, libraries or core dumps depending on e_type
+	if len(header) >= 18 && bytes.HasPrefix(header, []byte("\x7FELF")) {
+		eType := uint16(header[16]) | uint16(header[17])<<8
+		if header[5] == 2 { // big endian
+			eType = uint16(header[16])<<8 | uint16(header[17])
+		}
+		switch eType {
+		case 3:
+			return "application/x-sharedlib"
+		case 4:
+			return "application/x-coredump"
+		default:
+			return "application/x-executable"
+		}
+	}
+
+	contentType := http.DetectContentType(header)
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediaType
+	}
+	return contentType
+}
+
+// MatchContentType reports whether a content type matches a pattern such as
+// "application/zip" or "video/*"
+func MatchContentType(pattern, contentType string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(contentType, prefix+"/")
+	}
+	return pattern == contentType
+}
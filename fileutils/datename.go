@@ -0,0 +1,79 @@
+package fileutils
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// nameDatePattern finds dates such as 2024-03-01, 2024_03_01 or 20240301 in
+// file names, optionally followed by a time such as T1200, _12-00-00 or 120000
+var nameDatePattern = regexp.MustCompile(`(?:^|\D)(\d{4})[-_.]?(\d{2})[-_.]?(\d{2})(?:[T_ -]?(\d{2})[-:.]?(\d{2})(?:[-:.]?(\d{2}))?)?(?:\D|$)`)
+
+// DateFromName returns the first valid date embedded in a file name,
+// interpreted in local time
+func DateFromName(name string) (time.Time, bool) {
+	for _, match := range nameDatePattern.FindAllStringSubmatch(name, -1) {
+		var parts [6]int
+		for i, part := range match[1:] {
+			if part != "" {
+				parts[i], _ = strconv.Atoi(part)
+			}
+		}
+		year, month, day, hour, minute, second := parts[0], parts[1], parts[2], parts[3], parts[4], parts[5]
+		date := time.Date(year, time.Month(month), day, hour, minute, second, 0, time.Local)
+
+		// time.Date normalizes out of range values, so a round trip rejects them
+		if date.Year() != year || int(date.Month()) != month || date.Day() != day ||
+			date.Hour() != hour || date.Minute() != minute || date.Second() != second {
+			continue
+		}
+		return date, true
+	}
+	return time.Time{}, false
+}
+
+// DateParser extracts dates from file names with a configured pattern. The
+// pattern's first capture group, or the whole match if it has none, is
+// parsed with the layout, or detected like DateFromName without one. A nil
+// DateParser behaves like DateFromName.
+type DateParser struct {
+	pattern *regexp.Regexp
+	layout  string
+}
+
+// NewDateParser compiles a date pattern. It returns nil if pattern is empty.
+func NewDateParser(pattern, layout string) (*DateParser, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &DateParser{pattern: re, layout: layout}, nil
+}
+
+// Parse returns the date in a file name, interpreted in local time unless
+// the layout includes a zone
+func (p *DateParser) Parse(name string) (time.Time, bool) {
+	if p == nil {
+		return DateFromName(name)
+	}
+	match := p.pattern.FindStringSubmatch(name)
+	if match == nil {
+		return time.Time{}, false
+	}
+	text := match[0]
+	if len(match) > 1 {
+		text = match[1]
+	}
+	if p.layout == "" {
+		return DateFromName(text)
+	}
+	date, err := time.ParseInLocation(p.layout, text, time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return date, true
+}
@@ -12,9 +12,8 @@ func getDiskSpace(path string) (available, total uint64, err error) {
 		return 0, 0, err
 	}
 
-	// Convert to GB
-	available = (uint64(stat.Bavail) * uint64(stat.Bsize)) / (1024 * 1024 * 1024)
-	total = (uint64(stat.Blocks) * uint64(stat.Bsize)) / (1024 * 1024 * 1024)
+	available = uint64(stat.Bavail) * uint64(stat.Bsize)
+	total = uint64(stat.Blocks) * uint64(stat.Bsize)
 
 	return available, total, nil
 }
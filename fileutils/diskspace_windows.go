@@ -34,9 +34,5 @@ func getDiskSpace(path string) (available, total uint64, err error) {
 		return 0, 0, err
 	}
 
-	// Convert to GB
-	available = freeBytesAvailable / (1024 * 1024 * 1024)
-	total = totalBytes / (1024 * 1024 * 1024)
-
-	return available, total, nil
+	return freeBytesAvailable, totalBytes, nil
 }
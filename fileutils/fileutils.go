@@ -14,6 +14,35 @@ import (
 	"github.com/arkag/dirclean/utils"
 )
 
+// Prefixes of summary lines that record something other than a removed file
+const (
+	EmptyDirPrefix   = "EMPTY_DIR:"
+	CompressedPrefix = "COMPRESSED:"
+	// DirPrefix records a directory removed as a whole as "<bytes>:<path>"
+	DirPrefix = "DIR:"
+	// DuplicatePrefix records a duplicate file as "<bytes>:<path>"
+	DuplicatePrefix = "DUPLICATE:"
+)
+
+// TimeFunc returns the time a file's age is measured from. A nil TimeFunc
+// uses the modification time.
+type TimeFunc func(path string, info os.FileInfo) time.Time
+
+// SkipFunc reports whether a path is left out of directory analysis.
+// Skipped directories are not descended into. A nil SkipFunc skips nothing.
+type SkipFunc func(path string, info os.FileInfo) bool
+
+func (f SkipFunc) skips(path string, info os.FileInfo) bool {
+	return f != nil && f(path, info)
+}
+
+func (f TimeFunc) of(path string, info os.FileInfo) time.Time {
+	if f == nil {
+		return info.ModTime()
+	}
+	return f(path, info)
+}
+
 type DirInfo struct {
 	Path      string
 	Size      int64
@@ -34,12 +63,19 @@ func GetDF(path string) (map[string]uint64, error) {
 		return nil, err
 	}
 
-	diskUsage["Available"] = available
-	diskUsage["Total"] = total
+	// Convert to GB
+	diskUsage["Available"] = available / (1024 * 1024 * 1024)
+	diskUsage["Total"] = total / (1024 * 1024 * 1024)
 
 	return diskUsage, nil
 }
 
+// GetDiskSpace returns the bytes available to the current user and the total
+// size of the filesystem containing path
+func GetDiskSpace(path string) (available, total uint64, err error) {
+	return getDiskSpace(path)
+}
+
 func PrintSummary(tempFile string, dfBefore, dfAfter map[string]uint64, runID string, paths []string) {
 	fileCount := CountLines(tempFile)
 	fileSize := GetTotalSize(tempFile)
@@ -62,6 +98,18 @@ func PrintSummary(tempFile string, dfBefore, dfAfter map[string]uint64, runID st
 	fmt.Println("-------------------------------------------------------------------------------")
 	fmt.Printf("Total files processed:\t%d\n", fileCount)
 	fmt.Printf("Total size of files:\t%.2f GB\n", fileSize)
+	if dirCount, dirSize := GetDirectoryTotals(tempFile); dirCount > 0 {
+		fmt.Printf("Directories removed:\t%d\n", dirCount)
+		fmt.Printf("Size of directories:\t%s\n", FormatSize(dirSize))
+	}
+	if dupeCount, dupeSize := GetDuplicateTotals(tempFile); dupeCount > 0 {
+		fmt.Printf("Duplicate files:\t%d\n", dupeCount)
+		fmt.Printf("Size of duplicates:\t%s\n", FormatSize(dupeSize))
+	}
+	if compressedCount, saved := GetCompressionSavings(tempFile); compressedCount > 0 {
+		fmt.Printf("Files compressed:\t%d\n", compressedCount)
+		fmt.Printf("Saved by compression:\t%s\n", FormatSize(saved))
+	}
 
 	fmt.Println(GetDFDiff(dfBefore, dfAfter))
 	fmt.Println("-------------------------------------------------------------------------------")
@@ -99,6 +147,16 @@ func GetTotalSize(filename string) float64 {
 	for scanner.Scan() {
 		filePath := scanner.Text()
 
+		// Removed directories and duplicates carry their size, empty
+		// directories and compressed files are not counted
+		if bytes, ok := recordedSize(filePath); ok {
+			totalSize += bytes
+			continue
+		}
+		if strings.HasPrefix(filePath, EmptyDirPrefix) || strings.HasPrefix(filePath, CompressedPrefix) {
+			continue
+		}
+
 		// Use the existing utils.GetAbsPath function
 		absPath := utils.GetAbsPath(filePath)
 
@@ -126,6 +184,78 @@ func GetTotalSize(filename string) float64 {
 	return float64(totalSize) / (1024 * 1024 * 1024)
 }
 
+// GetCompressionSavings returns the number of files compressed and the total
+// bytes saved, as recorded in the summary temp file
+func GetCompressionSavings(filename string) (int, int64) {
+	return sumRecords(filename, CompressedPrefix)
+}
+
+// GetDirectoryTotals returns the number of directories removed as a whole
+// and their combined size, as recorded in the summary temp file
+func GetDirectoryTotals(filename string) (int, int64) {
+	return sumRecords(filename, DirPrefix)
+}
+
+// GetDuplicateTotals returns the number of duplicate files found or removed
+// and their combined size, as recorded in the summary temp file
+func GetDuplicateTotals(filename string) (int, int64) {
+	return sumRecords(filename, DuplicatePrefix)
+}
+
+// sumRecords counts the summary lines with prefix and adds up the byte
+// counts they record
+func sumRecords(filename, prefix string) (int, int64) {
+	file, err := os.Open(filename)
+	if err != nil {
+		logging.LogMessage("ERROR", fmt.Sprintf("Error opening file: %v", err))
+		return 0, 0
+	}
+	defer file.Close()
+
+	count := 0
+	var total int64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, ok := strings.CutPrefix(scanner.Text(), prefix)
+		if !ok {
+			continue
+		}
+		bytes, _, ok := parseRecord(line)
+		if !ok {
+			logging.LogMessage("ERROR", fmt.Sprintf("Invalid summary record: %s", scanner.Text()))
+			continue
+		}
+		count++
+		total += bytes
+	}
+	if err := scanner.Err(); err != nil {
+		logging.LogMessage("ERROR", fmt.Sprintf("Error scanning file: %v", err))
+	}
+	return count, total
+}
+
+// recordedSize returns the size recorded on a summary line for a removed
+// directory or a duplicate, and false for other lines
+func recordedSize(line string) (int64, bool) {
+	for _, prefix := range []string{DirPrefix, DuplicatePrefix} {
+		if record, ok := strings.CutPrefix(line, prefix); ok {
+			bytes, _, _ := parseRecord(record)
+			return bytes, true
+		}
+	}
+	return 0, false
+}
+
+// parseRecord splits a "<bytes>:<path>" summary record
+func parseRecord(record string) (int64, string, bool) {
+	bytesStr, path, _ := strings.Cut(record, ":")
+	bytes, err := strconv.ParseInt(bytesStr, 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return bytes, path, true
+}
+
 func GetDFDiff(before, after map[string]uint64) string {
 	if before["Available"] == after["Available"] {
 		return "No changes to file system"
@@ -139,7 +269,7 @@ Available space after: %d GB
 }
 
 // GetLargestDirs returns a sorted list of directories consuming the most space
-func GetLargestDirs(rootPaths []string, minSize int64) ([]DirInfo, error) {
+func GetLargestDirs(rootPaths []string, minSize int64, timeOf TimeFunc, skip SkipFunc) ([]DirInfo, error) {
 	var dirs []DirInfo
 	seen := make(map[string]bool)
 
@@ -151,13 +281,17 @@ func GetLargestDirs(rootPaths []string, minSize int64) ([]DirInfo, error) {
 			}
 
 			if info.IsDir() {
+				if skip.skips(path, info) {
+					return filepath.SkipDir
+				}
+
 				// Skip if we've already processed this directory
 				if seen[path] {
 					return filepath.SkipDir
 				}
 				seen[path] = true
 
-				dirInfo, err := analyzeDirUsage(path)
+				dirInfo, err := analyzeDirUsage(path, timeOf, skip)
 				if err != nil {
 					logging.LogMessage("ERROR", fmt.Sprintf("Error analyzing directory %s: %v", path, err))
 					return nil
@@ -182,8 +316,14 @@ func GetLargestDirs(rootPaths []string, minSize int64) ([]DirInfo, error) {
 	return dirs, nil
 }
 
+// GetDirInfo returns the size, file count and newest file time of everything
+// below a directory
+func GetDirInfo(dirPath string, timeOf TimeFunc) (DirInfo, error) {
+	return analyzeDirUsage(dirPath, timeOf, nil)
+}
+
 // analyzeDirUsage calculates directory size and last access time
-func analyzeDirUsage(dirPath string) (DirInfo, error) {
+func analyzeDirUsage(dirPath string, timeOf TimeFunc, skip SkipFunc) (DirInfo, error) {
 	var totalSize int64
 	var lastUsed time.Time
 	var fileCount int
@@ -193,11 +333,18 @@ func analyzeDirUsage(dirPath string) (DirInfo, error) {
 			return err
 		}
 
+		if skip.skips(path, info) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
 		if !info.IsDir() {
 			totalSize += info.Size()
 			fileCount++
-			if info.ModTime().After(lastUsed) {
-				lastUsed = info.ModTime()
+			if fileTime := timeOf.of(path, info); fileTime.After(lastUsed) {
+				lastUsed = fileTime
 			}
 		}
 		return nil
@@ -225,10 +372,11 @@ func FormatSize(bytes int64) string {
 	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
 
-// GetSuggestedDirs returns directories that are good candidates for cleanup
-func GetSuggestedDirs(rootPaths []string, minSizeMB int64) []DirInfo {
+// GetSuggestedDirs returns directories that are good candidates for cleanup:
+// large ones whose files have not been used for longer than olderThan
+func GetSuggestedDirs(rootPaths []string, minSizeMB int64, olderThan time.Duration, timeOf TimeFunc, skip SkipFunc) []DirInfo {
 	minSizeBytes := minSizeMB * 1024 * 1024
-	dirs, err := GetLargestDirs(rootPaths, minSizeBytes)
+	dirs, err := GetLargestDirs(rootPaths, minSizeBytes, timeOf, skip)
 	if err != nil {
 		logging.LogMessage("ERROR", fmt.Sprintf("Error getting largest directories: %v", err))
 		return nil
@@ -237,8 +385,8 @@ func GetSuggestedDirs(rootPaths []string, minSizeMB int64) []DirInfo {
 	// Filter and sort directories based on size and last use
 	var suggestions []DirInfo
 	for _, dir := range dirs {
-		// Consider directories that haven't been used in the last 30 days
-		if time.Since(dir.LastUsed) > 30*24*time.Hour {
+		// Consider directories that haven't been used within olderThan
+		if time.Since(dir.LastUsed) > olderThan {
 			suggestions = append(suggestions, dir)
 		}
 	}
@@ -251,16 +399,20 @@ func GetSuggestedDirs(rootPaths []string, minSizeMB int64) []DirInfo {
 	return suggestions
 }
 
-// IsOlderThan checks if a file is older than the specified number of days
-func IsOlderThan(path string, days int) bool {
+// IsOlderThan checks if a file is older than the specified number of days,
+// measured by the timestamp named by ageBy as for FileTime
+func IsOlderThan(path string, days int, ageBy string) bool {
 	info, err := os.Stat(path)
 	if err != nil {
 		return false
 	}
 
-	modTime := info.ModTime()
+	fileTime, ok := FileTime(path, info, ageBy)
+	if !ok {
+		return false
+	}
 	cutoff := time.Now().AddDate(0, 0, -days)
-	return modTime.Before(cutoff)
+	return fileTime.Before(cutoff)
 }
 
 // GetFileSize returns the size of a file in bytes
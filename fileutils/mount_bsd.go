@@ -0,0 +1,20 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package fileutils
+
+import "syscall"
+
+// mntNoAtime is MNT_NOATIME, which has the same value on macOS and FreeBSD
+const mntNoAtime = 0x10000000
+
+// NoAtime reports whether the filesystem containing path is mounted with
+// noatime, so that access times are never updated. ok is false if the
+// filesystem cannot be queried.
+func NoAtime(path string) (noatime bool, ok bool) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return false, false
+	}
+	return uint64(stat.Flags)&mntNoAtime != 0, true
+}
@@ -0,0 +1,10 @@
+//go:build netbsd
+// +build netbsd
+
+package fileutils
+
+// NoAtime reports whether the filesystem containing path is mounted with
+// noatime. Mount options are not checked on this platform, so ok is false.
+func NoAtime(path string) (noatime bool, ok bool) {
+	return false, false
+}
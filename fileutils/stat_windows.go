@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package fileutils
+
+import "os"
+
+// FileID returns the device and inode number of a file. They are not
+// available from os.FileInfo on Windows, so ok is always false.
+func FileID(info os.FileInfo) (device, inode uint64, ok bool) {
+	return 0, 0, false
+}
+
+// FileOwner returns the numeric user and group that own a file. Windows has
+// no numeric owners, so ok is always false.
+func FileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
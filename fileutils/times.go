@@ -0,0 +1,31 @@
+package fileutils
+
+import (
+	"os"
+	"time"
+)
+
+// FileTime returns the timestamp of a file named by which: "mtime" (last
+// modified), "atime" (last read), "ctime" (last status change), "btime"
+// (created) or "newest" (the latest of those available). ok is false when
+// the platform or filesystem does not provide the timestamp.
+func FileTime(path string, info os.FileInfo, which string) (time.Time, bool) {
+	switch which {
+	case "atime":
+		return AccessTime(info)
+	case "ctime":
+		return ChangeTime(info)
+	case "btime":
+		return BirthTime(path, info)
+	case "newest":
+		newest := info.ModTime()
+		for _, which := range []string{"atime", "ctime", "btime"} {
+			if t, ok := FileTime(path, info, which); ok && t.After(newest) {
+				newest = t
+			}
+		}
+		return newest, true
+	default:
+		return info.ModTime(), true
+	}
+}
@@ -0,0 +1,37 @@
+//go:build darwin || freebsd || netbsd
+// +build darwin freebsd netbsd
+
+package fileutils
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// AccessTime returns when a file was last read
+func AccessTime(info os.FileInfo) (time.Time, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(stat.Atimespec.Unix()), true
+}
+
+// ChangeTime returns when a file's contents or metadata last changed
+func ChangeTime(info os.FileInfo) (time.Time, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(stat.Ctimespec.Unix()), true
+}
+
+// BirthTime returns when a file was created
+func BirthTime(path string, info os.FileInfo) (time.Time, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat.Birthtimespec.Sec <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(stat.Birthtimespec.Unix()), true
+}
@@ -0,0 +1,99 @@
+//go:build linux
+// +build linux
+
+package fileutils
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// AccessTime returns when a file was last read
+func AccessTime(info os.FileInfo) (time.Time, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(stat.Atim.Unix()), true
+}
+
+// ChangeTime returns when a file's contents or metadata last changed
+func ChangeTime(info os.FileInfo) (time.Time, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(stat.Ctim.Unix()), true
+}
+
+// BirthTime returns when a file was created, using statx since stat does
+// not report it. Kernels before 4.11 and some filesystems do not record it.
+func BirthTime(path string, info os.FileInfo) (time.Time, bool) {
+	var stat unix.Statx_t
+	if err := unix.Statx(unix.AT_FDCWD, path, unix.AT_SYMLINK_NOFOLLOW, unix.STATX_BTIME, &stat); err != nil {
+		return time.Time{}, false
+	}
+	if stat.Mask&unix.STATX_BTIME == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(stat.Btime.Sec, int64(stat.Btime.Nsec)), true
+}
+
+// NoAtime reports whether the filesystem containing path is mounted with
+// noatime, so that access times are never updated. ok is false if the
+// mount options cannot be read.
+func NoAtime(path string) (noatime bool, ok bool) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false, false
+	}
+	if resolved, err := filepath.EvalSymlinks(absPath); err == nil {
+		absPath = resolved
+	}
+
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return false, false
+	}
+	defer f.Close()
+
+	// The mount with the longest mount point containing the path wins
+	best := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		mountPoint := unescapeMountField(fields[4])
+		if !containsPath(mountPoint, absPath) || len(mountPoint) < len(best) {
+			continue
+		}
+		best = mountPoint
+		noatime = false
+		for _, option := range strings.Split(fields[5], ",") {
+			if option == "noatime" {
+				noatime = true
+			}
+		}
+		ok = true
+	}
+	return noatime, ok
+}
+
+// unescapeMountField decodes the octal escapes mountinfo uses for spaces,
+// tabs, newlines and backslashes
+func unescapeMountField(field string) string {
+	replacer := strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`)
+	return replacer.Replace(field)
+}
+
+func containsPath(dir, path string) bool {
+	return dir == "/" || path == dir || strings.HasPrefix(path, dir+"/")
+}
@@ -0,0 +1,40 @@
+//go:build openbsd
+// +build openbsd
+
+package fileutils
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// AccessTime returns when a file was last read
+func AccessTime(info os.FileInfo) (time.Time, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(stat.Atim.Unix()), true
+}
+
+// ChangeTime returns when a file's contents or metadata last changed
+func ChangeTime(info os.FileInfo) (time.Time, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(stat.Ctim.Unix()), true
+}
+
+// BirthTime returns when a file was created. OpenBSD does not expose it, so
+// ok is always false.
+func BirthTime(path string, info os.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// NoAtime reports whether the filesystem containing path is mounted with
+// noatime. Mount options are not checked on this platform, so ok is false.
+func NoAtime(path string) (noatime bool, ok bool) {
+	return false, false
+}
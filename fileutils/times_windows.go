@@ -0,0 +1,41 @@
+//go:build windows
+// +build windows
+
+package fileutils
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// AccessTime returns when a file was last read
+func AccessTime(info os.FileInfo) (time.Time, bool) {
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, data.LastAccessTime.Nanoseconds()), true
+}
+
+// ChangeTime returns when a file's metadata last changed. It is not
+// available from os.FileInfo on Windows, so ok is always false.
+func ChangeTime(info os.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// BirthTime returns when a file was created
+func BirthTime(path string, info os.FileInfo) (time.Time, bool) {
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, data.CreationTime.Nanoseconds()), true
+}
+
+// NoAtime reports whether access times are disabled for path. NTFS last
+// access updates are a system-wide setting that is not checked, so ok is
+// false.
+func NoAtime(path string) (noatime bool, ok bool) {
+	return false, false
+}
@@ -0,0 +1,242 @@
+package glob
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Glob is a compiled glob pattern. Patterns are slash-separated and support
+// "*", "?", character classes ("[a-z]", "[!0-9]"), brace alternatives
+// ("{log,tmp}"), backslash escapes and "**" segments that match any number
+// of directories, including none.
+type Glob struct {
+	pattern      string
+	alternatives [][]string
+}
+
+// Compile parses a glob pattern, expanding braces and checking every segment
+// for syntax errors.
+func Compile(pattern string) (*Glob, error) {
+	expanded, err := Expand(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Glob{pattern: pattern}
+	for _, alt := range expanded {
+		segments := splitSegments(alt)
+		for _, segment := range segments {
+			if segment == "**" {
+				continue
+			}
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, fmt.Errorf("invalid glob pattern %s: %v", pattern, err)
+			}
+		}
+		g.alternatives = append(g.alternatives, segments)
+	}
+	return g, nil
+}
+
+// Match reports whether name matches pattern. It is a shorthand for Compile
+// followed by Glob.Match.
+func Match(pattern, name string) (bool, error) {
+	g, err := Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	return g.Match(name), nil
+}
+
+// String returns the source pattern
+func (g *Glob) String() string {
+	return g.pattern
+}
+
+// Match reports whether the slash-separated name matches the pattern
+func (g *Glob) Match(name string) bool {
+	nameSegments := splitSegments(name)
+	for _, segments := range g.alternatives {
+		if matchSegments(segments, nameSegments, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPrefix reports whether some path below the directory dir could match
+// the pattern. Walkers use it to prune directories that cannot contain matches.
+func (g *Glob) MatchPrefix(dir string) bool {
+	nameSegments := splitSegments(dir)
+	for _, segments := range g.alternatives {
+		if matchSegments(segments, nameSegments, true) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasMeta reports whether pattern contains any glob syntax
+func HasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[{\`)
+}
+
+// Base returns the longest leading run of path segments in pattern that
+// contain no glob syntax. It is the directory a walk for the pattern has to
+// start from. Relative patterns without a literal prefix return ".".
+func Base(pattern string) string {
+	segments := strings.Split(pattern, "/")
+	var literal []string
+	for _, segment := range segments {
+		if HasMeta(segment) {
+			break
+		}
+		literal = append(literal, segment)
+	}
+
+	base := strings.TrimSuffix(strings.Join(literal, "/"), "/")
+	switch {
+	case base == "" && strings.HasPrefix(pattern, "/"):
+		return "/"
+	case base == "":
+		return "."
+	case strings.HasSuffix(base, ":"):
+		// Keep Windows volume roots such as "C:/" rooted
+		return base + "/"
+	}
+	return base
+}
+
+// Expand performs brace expansion on pattern. Nested braces are supported;
+// braces without a top-level comma are kept literally.
+func Expand(pattern string) ([]string, error) {
+	open := -1
+	depth := 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{':
+			if depth == 0 {
+				open = i
+			}
+			depth++
+		case '}':
+			if depth == 0 {
+				return nil, fmt.Errorf("invalid glob pattern %s: unbalanced braces", pattern)
+			}
+			depth--
+			if depth > 0 {
+				continue
+			}
+
+			options := splitAlternatives(pattern[open+1 : i])
+			if len(options) < 2 {
+				// Not an alternative list, keep scanning after it
+				open = -1
+				continue
+			}
+
+			rest, err := Expand(pattern[i+1:])
+			if err != nil {
+				return nil, err
+			}
+			var results []string
+			for _, option := range options {
+				expanded, err := Expand(pattern[:open] + option)
+				if err != nil {
+					return nil, err
+				}
+				for _, head := range expanded {
+					for _, tail := range rest {
+						results = append(results, head+tail)
+					}
+				}
+			}
+			return results, nil
+		}
+	}
+
+	if depth != 0 {
+		return nil, fmt.Errorf("invalid glob pattern %s: unbalanced braces", pattern)
+	}
+	return []string{pattern}, nil
+}
+
+// splitAlternatives splits the contents of a brace group on top-level commas
+func splitAlternatives(group string) []string {
+	var options []string
+	depth := 0
+	start := 0
+	for i := 0; i < len(group); i++ {
+		switch group[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				options = append(options, group[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(options, group[start:])
+}
+
+// splitSegments splits a slash-separated path, keeping a leading empty
+// segment for absolute paths and dropping empty and "." segments elsewhere,
+// so "./logs/*" matches the cleaned paths a walk yields
+func splitSegments(p string) []string {
+	parts := strings.Split(p, "/")
+	segments := make([]string, 0, len(parts))
+	for i, part := range parts {
+		if part == "" && i != 0 {
+			continue
+		}
+		if part == "." {
+			continue
+		}
+		segments = append(segments, part)
+	}
+	return segments
+}
+
+// matchSegments matches pattern segments against name segments. In prefix
+// mode running out of name segments before the pattern counts as a match,
+// but a name that uses up the whole pattern does not, since nothing below
+// it can match.
+func matchSegments(pattern, name []string, prefix bool) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse consecutive "**" segments
+			for len(pattern) > 1 && pattern[1] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 || prefix {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:], prefix) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return prefix
+		}
+
+		matched, err := path.Match(pattern[0], name[0])
+		if err != nil || !matched {
+			return false
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+	return len(name) == 0 && !prefix
+}
@@ -5,3 +5,7 @@ go 1.23.6
 require gopkg.in/yaml.v3 v3.0.1
 
 require github.com/google/uuid v1.6.0
+
+require github.com/klauspost/compress v1.17.11
+
+require golang.org/x/sys v0.26.0
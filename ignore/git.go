@@ -0,0 +1,231 @@
+package ignore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GitDirName is the directory holding a repository's metadata
+const GitDirName = ".git"
+
+// Repo tells which files of a git work tree are ignored by git, using the
+// work tree's .gitignore files, .git/info/exclude and the index, without
+// running git
+type Repo struct {
+	Root    string
+	tree    *Tree
+	tracked map[string]bool
+	// sparse holds directories a sparse index records as a whole
+	sparse []string
+}
+
+// IsRepoRoot reports whether dir is the top of a git work tree, which has a
+// .git directory, or a .git file pointing to one for worktrees and
+// submodules
+func IsRepoRoot(dir string) bool {
+	_, err := os.Lstat(filepath.Join(dir, GitDirName))
+	return err == nil
+}
+
+// OpenRepo reads the index and exclude file of the work tree at root
+func OpenRepo(root string) (*Repo, error) {
+	root = filepath.Clean(root)
+	gitDir, commonDir, err := gitDirs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	repo := &Repo{
+		Root:    root,
+		tree:    NewTree(root, []string{".gitignore"}, ""),
+		tracked: make(map[string]bool),
+	}
+	exclude, err := ReadFile(filepath.Join(commonDir, "info", "exclude"))
+	if err != nil {
+		return nil, err
+	}
+	repo.tree.AddPatterns(exclude)
+
+	hashSize := 20
+	if objectFormat(commonDir) == "sha256" {
+		hashSize = 32
+	}
+	names, err := readIndex(filepath.Join(gitDir, "index"), hashSize)
+	if err != nil {
+		return nil, fmt.Errorf("error reading git index of %s: %v", root, err)
+	}
+	for _, name := range names {
+		if strings.HasSuffix(name, "/") {
+			repo.sparse = append(repo.sparse, name)
+			continue
+		}
+		repo.tracked[name] = true
+	}
+	return repo, nil
+}
+
+// Ignored reports whether a path in the work tree is ignored by git and not
+// tracked. Nothing inside .git is ever ignored.
+func (r *Repo) Ignored(path string, isDir bool) bool {
+	rel, ok := relSlash(r.Root, path)
+	if !ok || rel == "." {
+		return false
+	}
+	if rel == GitDirName || strings.HasPrefix(rel, GitDirName+"/") {
+		return false
+	}
+	if r.tracked[rel] {
+		return false
+	}
+	for _, dir := range r.sparse {
+		if strings.HasPrefix(rel+"/", dir) || (isDir && strings.HasPrefix(dir, rel+"/")) {
+			return false
+		}
+	}
+	return r.tree.Ignored(path, isDir)
+}
+
+// gitDirs returns the git directory of a work tree and the common directory
+// shared by its linked worktrees
+func gitDirs(root string) (gitDir, commonDir string, err error) {
+	gitDir = filepath.Join(root, GitDirName)
+	info, err := os.Stat(gitDir)
+	if err != nil {
+		return "", "", err
+	}
+	if !info.IsDir() {
+		// Worktrees and submodules have a file with "gitdir: <path>"
+		data, err := os.ReadFile(gitDir)
+		if err != nil {
+			return "", "", err
+		}
+		target, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+		if !ok {
+			return "", "", fmt.Errorf("invalid %s file in %s", GitDirName, root)
+		}
+		gitDir = filepath.FromSlash(strings.TrimSpace(target))
+		if !filepath.IsAbs(gitDir) {
+			gitDir = filepath.Join(root, gitDir)
+		}
+	}
+
+	commonDir = gitDir
+	if data, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir = filepath.FromSlash(strings.TrimSpace(string(data)))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+	}
+	return gitDir, commonDir, nil
+}
+
+// objectFormat returns the hash algorithm configured for a repository,
+// "sha1" unless extensions.objectFormat says otherwise
+func objectFormat(commonDir string) string {
+	f, err := os.Open(filepath.Join(commonDir, "config"))
+	if err != nil {
+		return "sha1"
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if ok && strings.EqualFold(strings.TrimSpace(key), "objectformat") {
+			return strings.ToLower(strings.TrimSpace(value))
+		}
+	}
+	return "sha1"
+}
+
+// readIndex returns the paths recorded in a git index file of version 2, 3
+// or 4. A missing index, as in a repository without commits, records
+// nothing.
+func readIndex(indexPath string, hashSize int) ([]string, error) {
+	data, err := os.ReadFile(indexPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 || string(data[:4]) != "DIRC" {
+		return nil, errors.New("not a git index")
+	}
+	version := binary.BigEndian.Uint32(data[4:8])
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("unsupported index version %d", version)
+	}
+	count := binary.BigEndian.Uint32(data[8:12])
+
+	// Each entry has 40 bytes of stat data, the object hash and 16 bits of
+	// flags before its path
+	fixed := 40 + hashSize + 2
+	names := make([]string, 0, count)
+	var previous string
+	pos := 12
+	for i := uint32(0); i < count; i++ {
+		start := pos
+		if pos+fixed > len(data) {
+			return nil, errors.New("truncated index")
+		}
+		flags := binary.BigEndian.Uint16(data[pos+fixed-2 : pos+fixed])
+		pos += fixed
+		if version >= 3 && flags&0x4000 != 0 {
+			pos += 2
+		}
+
+		var name string
+		if version == 4 {
+			// Paths are stored as a number of bytes to drop from the end of
+			// the previous path and the suffix to add
+			strip, n := readOffset(data[pos:])
+			if n == 0 || strip > len(previous) {
+				return nil, errors.New("invalid path compression")
+			}
+			pos += n
+			end := bytes.IndexByte(data[pos:], 0)
+			if end < 0 {
+				return nil, errors.New("truncated index")
+			}
+			name = previous[:len(previous)-strip] + string(data[pos:pos+end])
+			pos += end + 1
+		} else {
+			end := bytes.IndexByte(data[pos:], 0)
+			if end < 0 {
+				return nil, errors.New("truncated index")
+			}
+			name = string(data[pos : pos+end])
+			// Entries are padded with NULs to a multiple of 8 bytes
+			pos = start + (pos+end-start+8)&^7
+		}
+		names = append(names, name)
+		previous = name
+	}
+	return names, nil
+}
+
+// readOffset decodes the variable length integer used by index version 4
+// and returns it with the number of bytes read, or 0 bytes if it is
+// truncated
+func readOffset(data []byte) (int, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	value := int(data[0] & 0x7f)
+	n := 1
+	for data[n-1]&0x80 != 0 {
+		if n >= len(data) {
+			return 0, 0
+		}
+		value = (value+1)<<7 | int(data[n]&0x7f)
+		n++
+	}
+	return value, n
+}
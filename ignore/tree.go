@@ -0,0 +1,117 @@
+package ignore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/arkag/dirclean/logging"
+)
+
+// Tree applies the ignore files found in the directories below a root the
+// way git applies nested .gitignore files: patterns are relative to the
+// directory of their file, files in deeper directories take precedence, and
+// nothing inside an ignored directory can be re-included. Directories are
+// read once and cached, so a Tree should only live for one walk.
+type Tree struct {
+	root      string
+	fileNames []string
+	keepName  string
+	base      []Pattern
+	dirs      map[string]*dirState
+}
+
+type dirState struct {
+	patterns []Pattern
+	// ignored is set when the directory and everything below it is ignored
+	ignored bool
+}
+
+// NewTree returns a Tree that reads the ignore files named fileNames in
+// every directory below root. A directory containing a file named keepName
+// is ignored as a whole; an empty keepName disables that.
+func NewTree(root string, fileNames []string, keepName string) *Tree {
+	return &Tree{
+		root:      filepath.Clean(root),
+		fileNames: fileNames,
+		keepName:  keepName,
+		dirs:      make(map[string]*dirState),
+	}
+}
+
+// AddPatterns adds patterns that apply at the root with lower precedence
+// than the root's own ignore files, like .git/info/exclude. It must be
+// called before the tree is used.
+func (t *Tree) AddPatterns(patterns []Pattern) {
+	t.base = append(t.base, patterns...)
+}
+
+// Ignored reports whether a path below the tree's root is ignored. Paths
+// outside the root never are.
+func (t *Tree) Ignored(path string, isDir bool) bool {
+	path = filepath.Clean(path)
+	if _, ok := relSlash(t.root, path); !ok {
+		return false
+	}
+	if isDir {
+		return t.load(path).ignored
+	}
+	if t.load(filepath.Dir(path)).ignored {
+		return true
+	}
+	return t.matches(path, false)
+}
+
+// load returns the cached state of a directory, reading its ignore files on
+// first use
+func (t *Tree) load(dir string) *dirState {
+	if state, ok := t.dirs[dir]; ok {
+		return state
+	}
+
+	state := &dirState{}
+	if dir != t.root {
+		state.ignored = t.load(filepath.Dir(dir)).ignored || t.matches(dir, true)
+	}
+	if !state.ignored && t.keepName != "" {
+		if _, err := os.Lstat(filepath.Join(dir, t.keepName)); err == nil {
+			state.ignored = true
+		}
+	}
+	if !state.ignored {
+		if dir == t.root {
+			state.patterns = append(state.patterns, t.base...)
+		}
+		for _, name := range t.fileNames {
+			patterns, err := ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				logging.LogMessage("ERROR", fmt.Sprintf("Error reading ignore file %s: %v", filepath.Join(dir, name), err))
+				continue
+			}
+			state.patterns = append(state.patterns, patterns...)
+		}
+	}
+	t.dirs[dir] = state
+	return state
+}
+
+// matches applies the patterns of every directory from the root down to the
+// path's parent, deepest last
+func (t *Tree) matches(path string, isDir bool) bool {
+	var chain []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		chain = append(chain, dir)
+		if dir == t.root || filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	ignored := false
+	for i := len(chain) - 1; i >= 0; i-- {
+		rel, _ := relSlash(chain[i], path)
+		if result, ok := Match(t.load(chain[i]).patterns, rel, isDir); ok {
+			ignored = result
+		}
+	}
+	return ignored
+}
@@ -20,9 +20,14 @@ var (
 	configFlag   = flag.String("config", "config.yaml", "Path to config file (default: /etc/dirclean/config.yaml on Linux)")
 	logFlag      = flag.String("log", "", "Path to log file")
 	logLevelFlag = flag.String("log-level", "", "Log level (DEBUG, INFO, WARN, ERROR, FATAL)")
+	showConfig   = flag.Bool("show-effective-config", false, "Print every rule after merging defaults and exit")
 )
 
 func main() {
+	if exitCode, handled := runCommand(os.Args[1:]); handled {
+		os.Exit(exitCode)
+	}
+
 	flag.Parse()
 
 	if *versionFlag {
@@ -49,6 +54,16 @@ func main() {
 	}
 	globalConfig = config.LoadConfig(*configFlag)
 
+	if *showConfig {
+		out, err := config.EffectiveYAML(globalConfig)
+		if err != nil {
+			logging.LogMessage("FATAL", fmt.Sprintf("Error rendering effective config: %v", err))
+			os.Exit(1)
+		}
+		fmt.Print(string(out))
+		return
+	}
+
 	// Populate cliFlags with command line overrides
 	cliFlags = config.CLIFlags{
 		Mode:     *modeFlag,
@@ -56,17 +71,10 @@ func main() {
 		LogLevel: *logLevelFlag,
 	}
 
-	// Initialize logging with merged config
-	logging.InitLogging(globalConfig.Defaults.LogFile)
-	if cliFlags.LogFile != "" {
-		logging.InitLogging(cliFlags.LogFile)
-	}
+	initLogging(globalConfig, cliFlags)
 
-	// Set log level - first from config defaults, then override with CLI flag if present
-	logging.SetLogLevel(globalConfig.Defaults.LogLevel)
-	if cliFlags.LogLevel != "" {
-		logging.SetLogLevel(cliFlags.LogLevel)
-	}
+	runID := logging.GenerateUUID()
+	modes.SetRunID(runID)
 
 	dfBefore, err := fileutils.GetDF("/")
 	if err != nil {
@@ -110,5 +118,21 @@ func main() {
 		}
 	}
 
-	fileutils.PrintSummary(tempFile.Name(), dfBefore, dfAfter, logging.GenerateUUID(), uniquePaths)
+	fileutils.PrintSummary(tempFile.Name(), dfBefore, dfAfter, runID, uniquePaths)
+}
+
+// initLogging sets up the log file and level from the config defaults,
+// letting command line flags override them
+func initLogging(globalConfig config.GlobalConfig, cliFlags config.CLIFlags) {
+	// Initialize logging with merged config
+	logging.InitLogging(globalConfig.Defaults.LogFile)
+	if cliFlags.LogFile != "" {
+		logging.InitLogging(cliFlags.LogFile)
+	}
+
+	// Set log level - first from config defaults, then override with CLI flag if present
+	logging.SetLogLevel(globalConfig.Defaults.LogLevel)
+	if cliFlags.LogLevel != "" {
+		logging.SetLogLevel(cliFlags.LogLevel)
+	}
 }
@@ -0,0 +1,63 @@
+package modes
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/arkag/dirclean/config"
+	"github.com/arkag/dirclean/fileutils"
+	"github.com/arkag/dirclean/logging"
+)
+
+// ageTime returns the time a file's age is measured from: the date in its
+// name with age_source filename, otherwise or as a fallback the timestamp
+// named by age_by. Files without that timestamp use their modification time.
+func (state *ruleState) ageTime(config config.Config, path string, info os.FileInfo) time.Time {
+	if config.GetAgeSource() == "filename" {
+		if date, ok := state.dateParser.Parse(filepath.Base(path)); ok {
+			return date
+		}
+	}
+	fileTime, ok := fileutils.FileTime(path, info, config.GetAgeBy())
+	if !ok {
+		if !state.ageByUnavailable {
+			logging.LogMessage("WARN", fmt.Sprintf("%s is not available for %s, using mtime instead", config.GetAgeBy(), path))
+			state.ageByUnavailable = true
+		}
+		return info.ModTime()
+	}
+	return fileTime
+}
+
+// warnNoAtime warns when a rule measures age by atime on a filesystem that
+// is mounted noatime, where access times never advance
+func warnNoAtime(config config.Config, dirs []string) {
+	if config.GetAgeBy() != "atime" && config.GetAgeBy() != "newest" {
+		return
+	}
+	for _, dir := range dirs {
+		root := walkRoot(dir)
+		if noatime, ok := fileutils.NoAtime(root); ok && noatime {
+			message := fmt.Sprintf("%s is on a filesystem mounted noatime, access times are not updated and ages by %s are unreliable",
+				root, config.GetAgeBy())
+			logging.LogMessage("WARN", message)
+			if config.Mode == "analyze" {
+				fmt.Printf("Warning: %s\n", message)
+			}
+		}
+	}
+}
+
+// ageTimeFunc returns ageTime bound to a rule, for the analyze helpers
+func (state *ruleState) ageTimeFunc(config config.Config) fileutils.TimeFunc {
+	return func(path string, info os.FileInfo) time.Time {
+		return state.ageTime(config, path, info)
+	}
+}
+
+// cfgDuration formats an age the way it is written in the config
+func cfgDuration(age time.Duration) string {
+	return config.Duration(age).String()
+}
@@ -0,0 +1,190 @@
+package modes
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arkag/dirclean/config"
+	"github.com/arkag/dirclean/fileutils"
+	"github.com/arkag/dirclean/glob"
+	"github.com/arkag/dirclean/ignore"
+	"github.com/arkag/dirclean/logging"
+)
+
+// defaultArtifactDirs maps the marker files that identify a project to the
+// directories of dependencies and build output it accumulates. Go's vendor
+// directory is usually committed source, so it is only removed when
+// configured through artifact_dirs.
+var defaultArtifactDirs = map[string][]string{
+	"package.json":     {"node_modules"},
+	"Cargo.toml":       {"target"},
+	"pyproject.toml":   {".venv"},
+	"build.gradle":     {"build", ".gradle"},
+	"build.gradle.kts": {"build", ".gradle"},
+}
+
+// project is a directory with a marker file and artifact directories
+type project struct {
+	dir        string
+	root       string
+	artifacts  []string
+	lastActive time.Time
+}
+
+// artifactDirs returns the marker table with the rule's artifact_dirs
+// replacing the built-in entries of the same markers
+func artifactDirs(rule config.Config) map[string][]string {
+	markers := make(map[string][]string, len(defaultArtifactDirs)+len(rule.ArtifactDirs))
+	for marker, dirs := range defaultArtifactDirs {
+		markers[marker] = dirs
+	}
+	for marker, dirs := range rule.ArtifactDirs {
+		markers[marker] = dirs
+	}
+	return markers
+}
+
+// processProjects finds the projects below a rule's paths and removes the
+// artifact directories of those whose source files, everything outside the
+// artifact directories and .git, have not changed within age. Artifact
+// directories holding entries the rule excludes or filters out are kept.
+func processProjects(state *ruleState, config config.Config, matchedDirs []string, tempFile *os.File, age time.Duration) {
+	markers := artifactDirs(config)
+	projects := make(map[string]*project)
+	var order []string
+	addProject := func(dir, root string) {
+		if artifacts := findArtifacts(state, config, dir, root, markers); len(artifacts) > 0 {
+			projects[dir] = &project{dir: dir, root: root, artifacts: artifacts}
+			order = append(order, dir)
+		}
+	}
+
+	for _, dir := range matchedDirs {
+		// A plain path may be a project itself, which the walk does not
+		// pass to fn
+		if !glob.HasMeta(filepath.ToSlash(dir)) {
+			dir = filepath.Clean(dir)
+			addProject(dir, dir)
+		}
+
+		err := walkTrees(dir, state.skipFunc(config), func(path string, root string, info os.FileInfo) error {
+
+			if info.IsDir() {
+				// Artifacts are not sources, and dependencies carry
+				// markers of their own
+				if info.Name() == ignore.GitDirName {
+					return filepath.SkipDir
+				}
+				if parent, ok := projects[filepath.Dir(path)]; ok && slices.Contains(parent.artifacts, info.Name()) {
+					return filepath.SkipDir
+				}
+				addProject(path, root)
+				return nil
+			}
+
+			// A source file counts towards every project containing it
+			fileTime := state.ageTime(config, path, info)
+			for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+				if p, ok := projects[dir]; ok && fileTime.After(p.lastActive) {
+					p.lastActive = fileTime
+				}
+				if filepath.Dir(dir) == dir {
+					break
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			logging.LogMessage("ERROR", fmt.Sprintf("Error walking %s: %v", dir, err))
+		}
+	}
+
+	if config.Mode == "analyze" {
+		fmt.Println("\nStale projects:")
+		fmt.Println("===============")
+	}
+
+	cutoff := time.Now().Add(-age)
+	var staleCount int
+	var totalReclaimable int64
+	for _, dir := range order {
+		p := projects[dir]
+		if !p.lastActive.Before(cutoff) {
+			logging.LogMessage("DEBUG", fmt.Sprintf("Skipping active project %s (last source change %s)",
+				p.dir, p.lastActive.Format("2006-01-02")))
+			continue
+		}
+
+		var reclaimable, reclaimed int64
+		var sizes []string
+		for _, name := range p.artifacts {
+			// Removing artifacts takes along everything in them, so the
+			// rule's exclusions and filters apply to their contents
+			path := filepath.Join(p.dir, name)
+			dirInfo, blocked := dirUsage(state, config, path, p.root)
+			if blocked != "" {
+				logging.LogMessage("INFO", fmt.Sprintf("Keeping %s, it contains %s", path, blocked))
+				continue
+			}
+			reclaimable += dirInfo.Size
+			sizes = append(sizes, fmt.Sprintf("%s %s", name, fileutils.FormatSize(dirInfo.Size)))
+
+			reason := fmt.Sprintf("%s artifacts of project not changed for %s (last source change %s)",
+				name, cfgDuration(age), p.lastActive.Format("2006-01-02"))
+			if handleDirectory(config, path, dirInfo.Size, p.lastActive, reason, tempFile) {
+				reclaimed += dirInfo.Size
+			}
+		}
+		if len(sizes) == 0 {
+			continue
+		}
+		staleCount++
+		totalReclaimable += reclaimable
+
+		switch config.Mode {
+		case "analyze":
+			fmt.Printf("\n%d. Project: %s\n", staleCount, p.dir)
+			fmt.Printf("   Last source change: %s (%s ago)\n", p.lastActive.Format("2006-01-02"), formatTimeAgo(time.Since(p.lastActive)))
+			fmt.Printf("   Artifacts: %s\n", strings.Join(sizes, ", "))
+			fmt.Printf("   Reclaimable: %s\n", fileutils.FormatSize(reclaimable))
+		case "scheduled", "interactive":
+			logging.LogMessage("INFO", fmt.Sprintf("Project %s: reclaimed %s of %s (%s)",
+				p.dir, fileutils.FormatSize(reclaimed), fileutils.FormatSize(reclaimable), strings.Join(sizes, ", ")))
+		default:
+			logging.LogMessage("INFO", fmt.Sprintf("Project %s: %s reclaimable (%s)",
+				p.dir, fileutils.FormatSize(reclaimable), strings.Join(sizes, ", ")))
+		}
+	}
+
+	logging.LogMessage("INFO", fmt.Sprintf("Found %d projects, %d not changed for %s with %s of artifacts",
+		len(order), staleCount, cfgDuration(age), fileutils.FormatSize(totalReclaimable)))
+}
+
+// findArtifacts returns the artifact directories present in dir for the
+// marker files it contains, leaving out excluded and protected ones
+func findArtifacts(state *ruleState, config config.Config, dir, root string, markers map[string][]string) []string {
+	var names []string
+	for marker, artifacts := range markers {
+		if info, err := os.Lstat(filepath.Join(dir, marker)); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		for _, name := range artifacts {
+			path := filepath.Join(dir, name)
+			info, err := os.Lstat(path)
+			if err != nil || !info.IsDir() || slices.Contains(names, name) {
+				continue
+			}
+			if isExcluded(path, root, info, config.Exclude) || state.protected.skips(path, info) {
+				continue
+			}
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,45 @@
+package modes
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/arkag/dirclean/config"
+	"github.com/arkag/dirclean/fileutils"
+	"github.com/arkag/dirclean/logging"
+)
+
+// matchesContentType reports whether a file's sniffed type passes the rule's
+// content_types and exclude_content_types filters. Files that cannot be read
+// only pass if the rule has no content type filters, and neither do entries
+// other than regular files, as opening a FIFO or device could block.
+func matchesContentType(config config.Config, path string, info os.FileInfo) bool {
+	if len(config.ContentTypes) == 0 && len(config.ExcludeContentTypes) == 0 {
+		return true
+	}
+	if !info.Mode().IsRegular() {
+		logging.LogMessage("DEBUG", fmt.Sprintf("Skipping %s: content type filters only match regular files", path))
+		return false
+	}
+
+	contentType, err := fileutils.DetectContentType(path)
+	if err != nil {
+		logging.LogMessage("ERROR", fmt.Sprintf("Error detecting type of %s: %v", path, err))
+		return false
+	}
+	for _, pattern := range config.ExcludeContentTypes {
+		if fileutils.MatchContentType(pattern, contentType) {
+			logging.LogMessage("DEBUG", fmt.Sprintf("Skipping %s: excluded content type %s", path, contentType))
+			return false
+		}
+	}
+	if len(config.ContentTypes) == 0 {
+		return true
+	}
+	for _, pattern := range config.ContentTypes {
+		if fileutils.MatchContentType(pattern, contentType) {
+			return true
+		}
+	}
+	return false
+}
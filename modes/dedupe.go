@@ -0,0 +1,184 @@
+package modes
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/arkag/dirclean/config"
+	"github.com/arkag/dirclean/dupes"
+	"github.com/arkag/dirclean/fileutils"
+	"github.com/arkag/dirclean/logging"
+	"github.com/arkag/dirclean/plan"
+)
+
+// dedupeVerb describes what happens to a duplicate
+func dedupeVerb(action string) string {
+	switch action {
+	case "hardlink":
+		return "replace with hard link"
+	case "reflink":
+		return "replace with reflink"
+	case "report":
+		return "report"
+	default:
+		return "delete"
+	}
+}
+
+// processDuplicates groups the collected files by contents and handles the
+// copies that are not kept according to the rule's mode and dedupe action
+func processDuplicates(state *ruleState, config config.Config, tempFile *os.File) {
+	groups := dupes.Find(state.dupeFiles)
+	state.dupeFiles = nil
+
+	if config.Mode == "analyze" {
+		fmt.Println("\nDuplicate files:")
+		fmt.Println("================")
+		count, reclaimable := PrintDuplicates(groups, config.GetDedupeKeep(), config.DedupePrefer)
+		logging.LogMessage("INFO", fmt.Sprintf("Found %d duplicate files in %d groups, %s reclaimable",
+			count, len(groups), fileutils.FormatSize(reclaimable)))
+		return
+	}
+
+	var count int
+	var reclaimable int64
+	for i, group := range groups {
+		keep, duplicates := group.Split(config.GetDedupeKeep(), config.DedupePrefer)
+		count += len(duplicates)
+		reclaimable += group.Reclaimable()
+		handleDuplicates(config, i+1, group, keep, duplicates, tempFile)
+	}
+	logging.LogMessage("INFO", fmt.Sprintf("Found %d duplicate files in %d groups, %s reclaimable",
+		count, len(groups), fileutils.FormatSize(reclaimable)))
+}
+
+// PrintDuplicates lists duplicate groups with the copy each keeps and
+// returns the number of duplicates and the bytes they take
+func PrintDuplicates(groups []dupes.Group, policy string, preferred []string) (int, int64) {
+	var count int
+	var reclaimable int64
+	for i, group := range groups {
+		keep, duplicates := group.Split(policy, preferred)
+		count += len(duplicates)
+		reclaimable += group.Reclaimable()
+
+		fmt.Printf("\n%d. %d copies of %s, %s reclaimable (sha256 %s)\n",
+			i+1, len(group.Files), fileutils.FormatSize(group.Size), fileutils.FormatSize(group.Reclaimable()), group.SHA256[:16])
+		fmt.Printf("   keep: %s\n", keep.Path)
+		for _, dup := range duplicates {
+			fmt.Printf("         %s\n", dup.Path)
+		}
+	}
+	return count, reclaimable
+}
+
+// handleDuplicates applies the rule's mode to one group of duplicates
+func handleDuplicates(config config.Config, index int, group dupes.Group, keep dupes.File, duplicates []dupes.File, tempFile *os.File) {
+	verb := dedupeVerb(config.Dedupe)
+
+	switch mode := config.Mode; {
+	case config.Dedupe == "report":
+		for _, dup := range duplicates {
+			logging.LogMessage("INFO", fmt.Sprintf("Duplicate: %s (copy of %s, size: %s)",
+				dup.Path, keep.Path, fileutils.FormatSize(dup.Size)))
+			recordDuplicate(dup, tempFile)
+		}
+	case mode == "plan":
+		for _, dup := range duplicates {
+			reason := fmt.Sprintf("duplicate of %s", keep.Path)
+			if activePlan == nil {
+				logging.LogMessage("ERROR", fmt.Sprintf("No plan to record %s in", dup.Path))
+				return
+			}
+			if err := activePlan.AddDuplicate(dup.Path, keep.Path, config.Name, reason, config.Dedupe); err != nil {
+				logging.LogMessage("ERROR", fmt.Sprintf("Error adding %s to plan: %v", dup.Path, err))
+				continue
+			}
+			logging.LogMessage("INFO", fmt.Sprintf("Planned duplicate: %s (%s)", dup.Path, reason))
+		}
+	case mode == "interactive":
+		fmt.Print("\033[2K\r") // Clear current line
+		fmt.Printf("\n%s\n", strings.Repeat("-", 80))
+		fmt.Printf("Duplicates %d: %d copies of %s (sha256 %s)\n", index, len(group.Files), fileutils.FormatSize(group.Size), group.SHA256[:16])
+		fmt.Printf("Keep: %s\n", keep.Path)
+		for _, dup := range duplicates {
+			fmt.Printf("      %s\n", dup.Path)
+		}
+		fmt.Printf("%s\n", strings.Repeat("-", 80))
+		fmt.Printf("Actions: [d]edupe (%s), [s]kip, [q]uit: ", verb)
+
+		var response string
+		fmt.Scanln(&response)
+		switch strings.ToLower(strings.TrimSpace(response)) {
+		case "d":
+			for _, dup := range duplicates {
+				if err := applyDedupe(config.Dedupe, keep.Path, dup, tempFile); err == nil {
+					fmt.Printf("✓ Deduplicated: %s\n", dup.Path)
+				}
+			}
+		case "q":
+			fmt.Println("\nExiting interactive mode...")
+			os.Exit(0)
+		default:
+			fmt.Printf("→ Skipped %d duplicates of %s\n", len(duplicates), keep.Path)
+		}
+	case mode == "scheduled":
+		for _, dup := range duplicates {
+			applyDedupe(config.Dedupe, keep.Path, dup, tempFile)
+		}
+	default:
+		if mode != "dry-run" {
+			logging.LogMessage("WARN", fmt.Sprintf("Unknown mode: %s, defaulting to dry-run", mode))
+		}
+		for _, dup := range duplicates {
+			logging.LogMessage("INFO", fmt.Sprintf("Would %s duplicate: %s (copy of %s, size: %s)",
+				verb, dup.Path, keep.Path, fileutils.FormatSize(dup.Size)))
+			recordDuplicate(dup, tempFile)
+		}
+	}
+}
+
+// applyDedupe deletes a duplicate or replaces it with a link to the kept
+// copy, after checking that both still have the same contents
+func applyDedupe(action, keep string, dup dupes.File, tempFile *os.File) error {
+	same, err := dupes.SameContents(keep, dup.Path)
+	if err == nil && !same {
+		err = fmt.Errorf("contents differ from %s", keep)
+	}
+	if err != nil {
+		logging.LogMessage("WARN", fmt.Sprintf("Skipping duplicate %s: %v", dup.Path, err))
+		return err
+	}
+
+	switch action {
+	case "hardlink":
+		err = dupes.Hardlink(keep, dup.Path)
+	case "reflink":
+		err = dupes.Reflink(keep, dup.Path)
+	default:
+		err = os.Remove(dup.Path)
+	}
+	if err != nil {
+		logging.LogMessage("ERROR", fmt.Sprintf("Error deduplicating %s: %v", dup.Path, err))
+		return err
+	}
+
+	logging.LogMessage("INFO", fmt.Sprintf("Deduplicated %s (copy of %s, size: %s, action: %s)",
+		dup.Path, keep, fileutils.FormatSize(dup.Size), action))
+	recordDuplicate(dup, tempFile)
+	return nil
+}
+
+// recordDuplicate writes a duplicate to the temp file for the summary
+func recordDuplicate(dup dupes.File, tempFile *os.File) {
+	if _, err := fmt.Fprintf(tempFile, "%s%d:%s\n", fileutils.DuplicatePrefix, dup.Size, dup.Path); err != nil {
+		logging.LogMessage("ERROR", fmt.Sprintf("Error writing to temp file: %v", err))
+	}
+}
+
+// applyPlannedDuplicate handles a duplicate entry of a plan
+func applyPlannedDuplicate(entry plan.Entry, tempFile *os.File) error {
+	dup := dupes.File{Path: entry.Path, Size: entry.Size, ModTime: entry.ModTime}
+	return applyDedupe(entry.Action, entry.Original, dup, tempFile)
+}
@@ -0,0 +1,92 @@
+package modes
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/arkag/dirclean/config"
+	"github.com/arkag/dirclean/fileutils"
+	"github.com/arkag/dirclean/logging"
+	"github.com/arkag/dirclean/plan"
+	"github.com/arkag/dirclean/trash"
+)
+
+// handleDirectory applies the rule's mode to a directory that is removed as
+// a whole, like handleOldFile does for files. It returns whether the
+// directory was removed.
+func handleDirectory(config config.Config, path string, size int64, lastUsed time.Time, reason string, tempFile *os.File) bool {
+	verb, done := "Remove", "Removed"
+	if config.GetAction() == "trash" {
+		verb, done = "Move to trash", "Moved to trash"
+	}
+
+	switch config.Mode {
+	case "analyze":
+		logging.LogMessage("INFO", fmt.Sprintf("Found directory candidate: %s (size: %s, last used: %s)",
+			path, fileutils.FormatSize(size), lastUsed.Format("2006-01-02")))
+	case "plan":
+		recordPlanEntry(path, plan.KindDirectory, config.Name, reason, config.GetAction())
+	case "interactive":
+		fmt.Print("\033[2K\r") // Clear current line
+		fmt.Printf("\n%s\n", strings.Repeat("-", 80))
+		fmt.Printf("Directory: %s\n", path)
+		fmt.Printf("Size: %s\n", fileutils.FormatSize(size))
+		fmt.Printf("Last used: %s (%s ago)\n",
+			lastUsed.Format("2006-01-02 15:04:05"),
+			formatTimeAgo(time.Since(lastUsed)))
+		fmt.Printf("Reason: %s\n", reason)
+		fmt.Printf("%s\n", strings.Repeat("-", 80))
+		fmt.Printf("Actions: [d] %s, [s]kip, [q]uit: ", strings.ToLower(verb))
+
+		var response string
+		fmt.Scanln(&response)
+		switch strings.ToLower(strings.TrimSpace(response)) {
+		case "d":
+			if err := removeDirectory(config, path, size, tempFile); err == nil {
+				fmt.Printf("✓ %s: %s\n", done, path)
+				return true
+			}
+		case "q":
+			fmt.Println("\nExiting interactive mode...")
+			os.Exit(0)
+		default:
+			fmt.Printf("→ Skipped: %s\n", path)
+		}
+	case "scheduled":
+		return removeDirectory(config, path, size, tempFile) == nil
+	default:
+		if config.Mode != "dry-run" {
+			logging.LogMessage("WARN", fmt.Sprintf("Unknown mode: %s, defaulting to dry-run", config.Mode))
+		}
+		logging.LogMessage("INFO", fmt.Sprintf("Would %s directory: %s (size: %s, last used: %s)",
+			strings.ToLower(verb), path, fileutils.FormatSize(size), lastUsed.Format("2006-01-02")))
+		fmt.Fprintf(tempFile, "%s%d:%s\n", fileutils.DirPrefix, size, path)
+	}
+	return false
+}
+
+// removeDirectory deletes a directory and everything below it, or moves it
+// to the trash with action trash
+func removeDirectory(config config.Config, path string, size int64, tempFile *os.File) error {
+	if config.GetAction() == "trash" {
+		target, err := trash.Trash(path)
+		if err != nil {
+			logging.LogMessage("ERROR", fmt.Sprintf("Error moving directory %s to trash: %v", path, err))
+			return err
+		}
+		logging.LogMessage("INFO", fmt.Sprintf("Moved directory to trash: %s -> %s (size: %s)", path, target, fileutils.FormatSize(size)))
+	} else {
+		if err := os.RemoveAll(path); err != nil {
+			logging.LogMessage("ERROR", fmt.Sprintf("Error removing directory %s: %v", path, err))
+			return err
+		}
+		logging.LogMessage("INFO", fmt.Sprintf("Removed directory: %s (size: %s)", path, fileutils.FormatSize(size)))
+	}
+	// Write to temp file for summary
+	if _, err := fmt.Fprintf(tempFile, "%s%d:%s\n", fileutils.DirPrefix, size, path); err != nil {
+		logging.LogMessage("ERROR", fmt.Sprintf("Error writing to temp file: %v", err))
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package modes
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/arkag/dirclean/config"
+	"github.com/arkag/dirclean/fileutils"
+	"github.com/arkag/dirclean/glob"
+	"github.com/arkag/dirclean/ignore"
+	"github.com/arkag/dirclean/logging"
+)
+
+// processDirectories handles rules with unit directory: every directory
+// between min_depth and max_depth below the rule's paths, or below each
+// directory a glob pattern matches, is removed as a whole if its newest
+// entry is older than age. Directories that are still in use are searched
+// for old subdirectories down to max_depth.
+func processDirectories(state *ruleState, config config.Config, matchedDirs []string, tempFile *os.File, age time.Duration) {
+	minDepth, maxDepth := config.GetMinDepth(), config.GetMaxDepth()
+	cutoff := time.Now().Add(-age)
+
+	if config.Mode == "analyze" {
+		fmt.Println("\nOld directories:")
+		fmt.Println("================")
+	}
+
+	var count int
+	var total int64
+	for _, dir := range matchedDirs {
+		base := walkRoot(dir)
+		isPattern := glob.HasMeta(filepath.ToSlash(dir))
+		err := walkTrees(dir, state.skipFunc(config), func(path string, root string, info os.FileInfo) error {
+			if !info.IsDir() {
+				return nil
+			}
+			if state.failedFilter(config, path, info, 0, 0) != "" {
+				return filepath.SkipDir
+			}
+
+			// Depth counts from the directories the path selects. The only
+			// paths walkTrees passes with the pattern's base as root are the
+			// directories the pattern matches.
+			depth := pathDepth(root, path)
+			if isPattern && root == base {
+				depth = 0
+			}
+			if depth < minDepth {
+				return nil
+			}
+			if depth > maxDepth {
+				return filepath.SkipDir
+			}
+
+			usage, blocked := dirUsage(state, config, path, root)
+			switch {
+			case blocked != "":
+				logging.LogMessage("DEBUG", fmt.Sprintf("Not removing %s as a whole, it contains %s", path, blocked))
+			case usage.LastUsed.Before(cutoff):
+				count++
+				total += usage.Size
+				if config.Mode == "analyze" {
+					fmt.Printf("\n%d. Directory: %s\n", count, path)
+					fmt.Printf("   Total size: %s\n", fileutils.FormatSize(usage.Size))
+					fmt.Printf("   Last used: %s (%s ago)\n", usage.LastUsed.Format("2006-01-02"), formatTimeAgo(time.Since(usage.LastUsed)))
+					fmt.Printf("   Files: %d\n", usage.FileCount)
+				}
+				reason := fmt.Sprintf("newest entry older than %s (last used %s)",
+					cfgDuration(age), usage.LastUsed.Format("2006-01-02"))
+				handleDirectory(config, path, usage.Size, usage.LastUsed, reason, tempFile)
+				return filepath.SkipDir
+			}
+
+			if depth == maxDepth {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			logging.LogMessage("ERROR", fmt.Sprintf("Error walking %s: %v", dir, err))
+		}
+	}
+
+	logging.LogMessage("INFO", fmt.Sprintf("Found %d directories not used for %s with %s of files",
+		count, cfgDuration(age), fileutils.FormatSize(total)))
+}
+
+// pathDepth returns how many directories path is below base
+func pathDepth(base, path string) int {
+	rel, err := filepath.Rel(base, path)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return len(strings.Split(rel, string(filepath.Separator)))
+}
+
+// dirUsage measures a directory's size, file count and the newest time of
+// any entry below it, using the directory's own time when it is empty. If
+// the directory holds excluded or protected entries, or files the rule's
+// filters would leave alone, which removing it as a whole would take along,
+// the first one is returned as blocked.
+func dirUsage(state *ruleState, config config.Config, dir, root string) (usage fileutils.DirInfo, blocked string) {
+	usage.Path = dir
+	minBytes, maxBytes := sizeLimits(config)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		if isExcluded(path, root, info, config.Exclude) || state.protected.skips(path, info) {
+			blocked = path
+			return filepath.SkipAll
+		}
+		if filter := state.failedFilter(config, path, info, minBytes, maxBytes); filter != "" {
+			blocked = fmt.Sprintf("%s, which fails the %s filter", path, filter)
+			return filepath.SkipAll
+		}
+
+		if entryTime := state.ageTime(config, path, info); entryTime.After(usage.LastUsed) {
+			usage.LastUsed = entryTime
+		}
+		if info.Mode().IsRegular() {
+			usage.Size += info.Size()
+			usage.FileCount++
+		}
+		return nil
+	})
+	if err != nil {
+		// An unreadable entry could be in use, so the directory is kept
+		return usage, fmt.Sprintf("an unreadable entry (%v)", err)
+	}
+
+	if usage.LastUsed.IsZero() {
+		if info, err := os.Lstat(dir); err == nil {
+			usage.LastUsed = state.ageTime(config, dir, info)
+		}
+	}
+	return usage, blocked
+}
+
+// failedFilter returns the name of the first of the rule's file filters an
+// entry fails, or "" if it passes them all. Directories only fail
+// only_git_ignored by being a .git directory, which git never ignores.
+func (state *ruleState) failedFilter(config config.Config, path string, info os.FileInfo, minBytes, maxBytes int64) string {
+	if info.IsDir() {
+		if config.ShouldOnlyCleanGitIgnored() && info.Name() == ignore.GitDirName {
+			return "only_git_ignored"
+		}
+		return ""
+	}
+	if !matchesRegex(config, path) {
+		return "name and path regex"
+	}
+	if config.ShouldOnlyCleanGitIgnored() && !state.gitIgnored(path, false) {
+		return "only_git_ignored"
+	}
+	if !state.owners.matches(info) {
+		return "owner and permission"
+	}
+	if (minBytes > 0 && info.Size() < minBytes) || (maxBytes > 0 && info.Size() > maxBytes) {
+		return "file size"
+	}
+	if !matchesContentType(config, path, info) {
+		return "content type"
+	}
+	return ""
+}
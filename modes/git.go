@@ -0,0 +1,63 @@
+package modes
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/arkag/dirclean/ignore"
+	"github.com/arkag/dirclean/logging"
+)
+
+// addGitRepo reads the work tree at dir unless it is already known
+func (state *ruleState) addGitRepo(dir string) {
+	if _, ok := state.gitRepos[dir]; ok {
+		return
+	}
+	repo, err := ignore.OpenRepo(dir)
+	if err != nil {
+		logging.LogMessage("ERROR", fmt.Sprintf("Error reading git repository %s, skipping its files: %v", dir, err))
+		state.gitRepos[dir] = nil
+		return
+	}
+	logging.LogMessage("DEBUG", fmt.Sprintf("Found git repository: %s", dir))
+	state.gitRepos[dir] = repo
+}
+
+// gitRootFor returns the innermost work tree containing dir, looking for
+// one in dir and its parents, so repositories are found no matter which
+// directories the walk passes through
+func (state *ruleState) gitRootFor(dir string) string {
+	var visited []string
+	root := ""
+	for d := dir; ; d = filepath.Dir(d) {
+		if known, ok := state.gitRoots[d]; ok {
+			root = known
+			break
+		}
+		visited = append(visited, d)
+		if ignore.IsRepoRoot(d) {
+			state.addGitRepo(d)
+			root = d
+			break
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	for _, d := range visited {
+		state.gitRoots[d] = root
+	}
+	return root
+}
+
+// gitIgnored reports whether git ignores a path in the innermost work tree
+// containing it. Paths outside any work tree are not ignored.
+func (state *ruleState) gitIgnored(path string, isDir bool) bool {
+	path = filepath.Clean(path)
+	root := state.gitRootFor(filepath.Dir(path))
+	if root == "" {
+		return false
+	}
+	repo := state.gitRepos[root]
+	return repo != nil && repo.Ignored(path, isDir)
+}
@@ -1,107 +1,124 @@
 package modes
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/arkag/dirclean/archive"
 	"github.com/arkag/dirclean/config"
+	"github.com/arkag/dirclean/dupes"
 	"github.com/arkag/dirclean/fileutils"
+	"github.com/arkag/dirclean/glob"
+	"github.com/arkag/dirclean/ignore"
 	"github.com/arkag/dirclean/logging"
+	"github.com/arkag/dirclean/plan"
+	"github.com/arkag/dirclean/quarantine"
+	"github.com/arkag/dirclean/trash"
 )
 
+// runID identifies the current run, for example in quarantine manifests
+var runID string
+
+// SetRunID sets the ID of the current run
+func SetRunID(id string) {
+	runID = id
+}
+
+// archiveQueue holds the files each rule with action archive selected, by
+// rule name, until they are written to the rule's archive
+var archiveQueue = map[string][]string{}
+
+// activePlan collects candidates instead of acting on them when rules are
+// processed in "plan" mode
+var activePlan *plan.Plan
+
+// SetPlan sets the plan that "plan" mode records candidates into
+func SetPlan(p *plan.Plan) {
+	activePlan = p
+}
+
 func ProcessFiles(config config.Config, tempFile *os.File) {
-	days := config.OlderThanDays
+	age := config.GetOlderThan()
 	paths := config.Paths
 
-	if days <= 0 {
-		logging.LogMessage("ERROR", fmt.Sprintf("Invalid days value: %d", days))
+	// Retention, a free space target, a quota or dedupe selects files on
+	// its own, so the age is optional
+	if age < 0 || (age == 0 && !selectsCandidates(config) && config.Dedupe == "") {
+		logging.LogMessage("ERROR", fmt.Sprintf("Invalid age: %s (set older_than or older_than_days)", cfgDuration(age)))
 		return
 	}
 
-	// Convert file size limits to bytes
-	var minBytes, maxBytes int64
-	if config.MinFileSize != nil {
-		minBytes = config.MinFileSize.ToBytes()
+	minBytes, maxBytes := sizeLimits(config)
+
+	matchedDirs := ValidateDirs(paths)
+	var roots []string
+	for _, dir := range matchedDirs {
+		roots = append(roots, walkRoot(dir))
 	}
-	if config.MaxFileSize != nil {
-		maxBytes = config.MaxFileSize.ToBytes()
+
+	state, err := newRuleState(config, roots)
+	if err != nil {
+		logging.LogMessage("ERROR", fmt.Sprintf("Skipping rule %s: %v", config.Name, err))
+		return
 	}
 
-	matchedDirs := ValidateDirs(paths)
+	// Purge files quarantined by earlier runs before adding new ones
+	if config.GetAction() == "quarantine" && config.GetQuarantineDays() > 0 {
+		purgeQuarantine(config)
+	}
+
+	if config.GetKind() == "project_artifacts" {
+		processProjects(state, config, matchedDirs, tempFile, age)
+		return
+	}
+	if config.GetUnit() == "directory" {
+		processDirectories(state, config, matchedDirs, tempFile, age)
+		return
+	}
 
 	if config.Mode == "analyze" {
 		fmt.Println("\nAnalyzing directories for old files and broken symlinks...")
 		fmt.Println("===================================================")
 	}
+	warnNoAtime(config, matchedDirs)
 
 	for _, dir := range matchedDirs {
-		// Handle wildcard paths
-		if strings.Contains(dir, "*") {
-			basePath := dir[:strings.Index(dir, "*")]
-			pattern := dir[strings.Index(dir, "*"):]
-
-			// Walk the base path
-			err := filepath.Walk(basePath, func(path string, info os.FileInfo, err error) error {
-				if err != nil {
-					logging.LogMessage("ERROR", fmt.Sprintf("Error accessing %s: %v", path, err))
-					return filepath.SkipDir
-				}
-
-				// Special handling for "**" pattern
-				if strings.Contains(dir, "**") {
-					if !info.IsDir() {
-						// For "**" patterns, process all files regardless of depth
-						return processPath(path, info, config, tempFile, days, minBytes, maxBytes)
-					}
-					return nil
-				}
-
-				// Regular wildcard handling
-				matched, err := filepath.Match(pattern, path[len(basePath):])
-				if err != nil {
-					logging.LogMessage("ERROR", fmt.Sprintf("Error matching pattern: %v", err))
-					return nil
-				}
-
-				if matched {
-					return processPath(path, info, config, tempFile, days, minBytes, maxBytes)
-				}
-				return nil
-			})
+		err := walkPattern(dir, state.skipFunc(config), func(path string, root string, info os.FileInfo) error {
+			return processPath(state, path, root, info, config, tempFile, age, minBytes, maxBytes)
+		})
+		if err != nil {
+			logging.LogMessage("ERROR", fmt.Sprintf("Error walking %s: %v", dir, err))
+		}
+	}
 
-			if err != nil {
-				logging.LogMessage("ERROR", fmt.Sprintf("Error walking directory %s: %v", basePath, err))
-			}
+	if selectsCandidates(config) {
+		for _, file := range state.selectCandidates(config) {
+			handleOldFile(config, file.path, file.size, file.modTime, file.reason, tempFile)
+		}
+		state.candidates = nil
+	}
+	if config.Dedupe != "" {
+		processDuplicates(state, config, tempFile)
+	}
 
-			// Clean up empty directories after processing files
-			if config.CleanEmptyDirs {
-				cleanEmptyDirs(basePath, config.Mode, tempFile)
-			}
-		} else {
-			// Handle non-wildcard paths as before
-			err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-				if err != nil {
-					logging.LogMessage("ERROR", fmt.Sprintf("Error accessing %s: %v", path, err))
-					return nil
-				}
-				return processPath(path, info, config, tempFile, days, minBytes, maxBytes)
-			})
-			if err != nil {
-				logging.LogMessage("ERROR", fmt.Sprintf("Error walking directory %s: %v", dir, err))
-			}
+	// Archived files are only deleted once the whole archive is written
+	if config.GetAction() == "archive" {
+		flushArchive(config, tempFile)
+	}
 
-			// Clean up empty directories after processing files
-			if config.CleanEmptyDirs {
-				cleanEmptyDirs(dir, config.Mode, tempFile)
-			}
+	// Clean up empty directories after processing files
+	if config.ShouldCleanEmptyDirs() {
+		for _, dir := range matchedDirs {
+			cleanEmptyDirs(state, dir, config, tempFile)
 		}
 	}
 
 	if config.Mode == "analyze" {
-		suggestions := fileutils.GetSuggestedDirs(paths, 100) // 100MB minimum size
+		suggestions := fileutils.GetSuggestedDirs(roots, 100, age, state.ageTimeFunc(config), state.protected.skips) // 100MB minimum size
 		if len(suggestions) > 0 {
 			fmt.Println("\nLarge directories that may need attention:")
 			fmt.Println("=========================================")
@@ -118,8 +135,14 @@ func ProcessFiles(config config.Config, tempFile *os.File) {
 					if err != nil {
 						return nil
 					}
+					if state.protected.skips(path, info) {
+						if info.IsDir() {
+							return filepath.SkipDir
+						}
+						return nil
+					}
 					if !info.IsDir() {
-						if info.ModTime().Before(time.Now().AddDate(0, 0, -days)) {
+						if state.ageTime(config, path, info).Before(time.Now().Add(-age)) {
 							oldFilesCount++
 							oldFilesSize += info.Size()
 						}
@@ -136,7 +159,7 @@ func ProcessFiles(config config.Config, tempFile *os.File) {
 
 			fmt.Println("\nTo clean these directories:")
 			fmt.Println("1. Add them to your config file, or")
-			fmt.Printf("2. Run: dirclean --mode=interactive --path=<directory_path> --days=%d\n", days)
+			fmt.Printf("2. Run: dirclean --mode=interactive --path=<directory_path> --older-than=%s\n", cfgDuration(age))
 		}
 	}
 }
@@ -144,55 +167,167 @@ func ProcessFiles(config config.Config, tempFile *os.File) {
 func ValidateDirs(dirs []string) []string {
 	var matchedDirs []string
 	for _, dir := range dirs {
-		// If the path contains wildcards, add it directly to matched dirs
-		if strings.Contains(dir, "*") {
-			// Special handling for "**" pattern
-			if strings.Contains(dir, "**") {
-				// Extract the base path (everything before **)
-				basePath := dir[:strings.Index(dir, "**")]
-				if basePath == "" {
-					logging.LogMessage("ERROR", fmt.Sprintf("Invalid recursive path: %s", dir))
-					continue
-				}
-
-				// Verify the base path exists
-				if info, err := os.Stat(basePath); err == nil && info.IsDir() {
-					logging.LogMessage("DEBUG", fmt.Sprintf("Added recursive path: %s", dir))
-					matchedDirs = append(matchedDirs, dir)
-				} else {
-					logging.LogMessage("ERROR", fmt.Sprintf("Base directory does not exist or is not accessible: %s", basePath))
-				}
-				continue
-			}
-
-			// Handle regular wildcards
-			basePath := dir[:strings.Index(dir, "*")]
-			if basePath == "" {
-				logging.LogMessage("ERROR", fmt.Sprintf("Invalid wildcard path: %s", dir))
+		root := dir
+		if glob.HasMeta(filepath.ToSlash(dir)) {
+			if _, err := glob.Compile(filepath.ToSlash(dir)); err != nil {
+				logging.LogMessage("ERROR", fmt.Sprintf("Invalid path pattern: %v", err))
 				continue
 			}
+			root = walkRoot(dir)
+		}
 
-			// Verify the base path exists
-			if info, err := os.Stat(basePath); err == nil && info.IsDir() {
-				logging.LogMessage("DEBUG", fmt.Sprintf("Added wildcard path: %s", dir))
-				matchedDirs = append(matchedDirs, dir)
-			} else {
-				logging.LogMessage("ERROR", fmt.Sprintf("Base directory does not exist or is not accessible: %s", basePath))
-			}
-		} else if info, err := os.Stat(dir); err == nil && info.IsDir() {
-			logging.LogMessage("DEBUG", fmt.Sprintf("Matched directory: %s", dir))
+		// Verify the directory the walk starts from exists
+		if info, err := os.Stat(root); err == nil && info.IsDir() {
+			logging.LogMessage("DEBUG", fmt.Sprintf("Matched path: %s (walk root: %s)", dir, root))
 			matchedDirs = append(matchedDirs, dir)
 		} else {
-			logging.LogMessage("ERROR", fmt.Sprintf("Directory does not exist or is not accessible: %s", dir))
+			logging.LogMessage("ERROR", fmt.Sprintf("Directory does not exist or is not accessible: %s", root))
 		}
 	}
 	return matchedDirs
 }
 
-func handleBrokenSymlink(mode string, path string, tempFile *os.File) {
+// walkSkip reports whether a walk leaves out a path, and everything below it
+// if it is a directory
+type walkSkip func(path string, root string, info os.FileInfo) bool
+
+// walkRoot returns the directory a walk for a configured path starts from:
+// the path itself, or the longest literal prefix of a glob pattern
+func walkRoot(pattern string) string {
+	if !glob.HasMeta(filepath.ToSlash(pattern)) {
+		return pattern
+	}
+	return filepath.FromSlash(glob.Base(filepath.ToSlash(pattern)))
+}
+
+// walkPattern walks everything selected by a configured path. A plain path
+// selects its whole tree. A glob pattern is walked from its literal prefix
+// and selects exactly the paths it matches, so "/tmp/*" selects the entries
+// of /tmp and "/tmp/**" everything below it. fn receives the root each path
+// was selected through, which is what exclude patterns are relative to. The
+// walk roots themselves are not passed to fn. Every path walked, including
+// directories that are only passed through on the way to a match, is first
+// checked with skip, and skipped paths are neither passed to fn nor entered.
+func walkPattern(pattern string, skip walkSkip, fn func(path string, root string, info os.FileInfo) error) error {
+	if !glob.HasMeta(filepath.ToSlash(pattern)) {
+		return walkTree(pattern, skip, fn)
+	}
+
+	g, err := glob.Compile(filepath.ToSlash(pattern))
+	if err != nil {
+		return err
+	}
+	base := walkRoot(pattern)
+
+	return filepath.Walk(base, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			logging.LogMessage("ERROR", fmt.Sprintf("Error accessing %s: %v", path, err))
+			return nil
+		}
+		if path == base {
+			return nil
+		}
+		if skip(path, base, info) {
+			return skipExcluded(path, info)
+		}
+
+		slashPath := filepath.ToSlash(path)
+		if g.Match(slashPath) {
+			if err := fn(path, base, info); err != nil {
+				return err
+			}
+		}
+
+		// Prune directories that cannot contain a match
+		if info.IsDir() && !g.MatchPrefix(slashPath) {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+// walkTrees walks the trees of the directories selected by a configured
+// path, for rules that remove directories or look at them as a whole. A
+// plain path selects itself. Directories matched by a glob pattern are
+// passed to fn with the pattern's literal prefix as root, and the paths
+// below them with the matched directory as root. Paths are checked with skip
+// as in walkPattern.
+func walkTrees(pattern string, skip walkSkip, fn func(path string, root string, info os.FileInfo) error) error {
+	if !glob.HasMeta(filepath.ToSlash(pattern)) {
+		return walkTree(pattern, skip, fn)
+	}
+
+	g, err := glob.Compile(filepath.ToSlash(pattern))
+	if err != nil {
+		return err
+	}
+	base := walkRoot(pattern)
+
+	// selected is the most recent directory matched by the pattern; everything
+	// below it is part of the selection without further matching
+	selected := ""
+	return filepath.Walk(base, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			logging.LogMessage("ERROR", fmt.Sprintf("Error accessing %s: %v", path, err))
+			return nil
+		}
+		if path == base {
+			return nil
+		}
+
+		if selected != "" && strings.HasPrefix(path, selected+string(filepath.Separator)) {
+			if skip(path, selected, info) {
+				return skipExcluded(path, info)
+			}
+			return fn(path, selected, info)
+		}
+		selected = ""
+		if skip(path, base, info) {
+			return skipExcluded(path, info)
+		}
+
+		slashPath := filepath.ToSlash(path)
+		if info.IsDir() && g.Match(slashPath) {
+			if err := fn(path, base, info); err != nil {
+				return err
+			}
+			selected = path
+			return nil
+		}
+
+		// Prune directories that cannot contain a match
+		if info.IsDir() && !g.MatchPrefix(slashPath) {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+// walkTree walks everything below dir, passing dir as the root. Paths are
+// checked with skip as in walkPattern.
+func walkTree(dir string, skip walkSkip, fn func(path string, root string, info os.FileInfo) error) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			logging.LogMessage("ERROR", fmt.Sprintf("Error accessing %s: %v", path, err))
+			return nil
+		}
+		if path == dir {
+			return nil
+		}
+		if skip(path, dir, info) {
+			return skipExcluded(path, info)
+		}
+		return fn(path, dir, info)
+	})
+}
+
+func handleBrokenSymlink(config config.Config, path string, tempFile *os.File) {
+	mode := config.Mode
 	switch mode {
 	case "analyze":
 		logging.LogMessage("INFO", fmt.Sprintf("Found broken symlink: %s", path))
+	case "plan":
+		recordPlanEntry(path, plan.KindBrokenSymlink, config.Name, "broken symlink", "delete")
 	case "dry-run":
 		logging.LogMessage("INFO", fmt.Sprintf("Would delete broken symlink: %s", path))
 		fmt.Fprintln(tempFile, path)
@@ -212,14 +347,18 @@ func handleBrokenSymlink(mode string, path string, tempFile *os.File) {
 	}
 }
 
-func handleOldFile(mode string, path string, fileSize int64, modTime time.Time, tempFile *os.File) {
+func handleOldFile(config config.Config, path string, fileSize int64, modTime time.Time, reason string, tempFile *os.File) {
+	mode := config.Mode
+	messages := messagesFor(config.GetAction())
 	switch mode {
 	case "analyze":
 		logging.LogMessage("INFO", fmt.Sprintf("Found candidate: %s (size: %s, modified: %s)",
 			path, fileutils.FormatSize(fileSize), modTime.Format("2006-01-02")))
+	case "plan":
+		recordPlanEntry(path, plan.KindFile, config.Name, reason, config.GetAction())
 	case "dry-run":
-		logging.LogMessage("INFO", fmt.Sprintf("Would delete file: %s (size: %s, modified: %s)",
-			path, fileutils.FormatSize(fileSize), modTime.Format("2006-01-02")))
+		logging.LogMessage("INFO", fmt.Sprintf("%s: %s (size: %s, modified: %s)",
+			messages.would, path, fileutils.FormatSize(fileSize), modTime.Format("2006-01-02")))
 		fmt.Fprintln(tempFile, path)
 	case "interactive":
 		// Clear line and print file info
@@ -227,17 +366,28 @@ func handleOldFile(mode string, path string, fileSize int64, modTime time.Time,
 		fmt.Printf("\n%s\n", strings.Repeat("-", 80))
 		fmt.Printf("File: %s\n", path)
 		fmt.Printf("Size: %s\n", fileutils.FormatSize(fileSize))
+		info, err := os.Lstat(path)
+		if err == nil {
+			if owner, ok := ownerName(info); ok {
+				fmt.Printf("Owner: %s\n", owner)
+			}
+		}
 		fmt.Printf("Modified: %s (%s ago)\n",
 			modTime.Format("2006-01-02 15:04:05"),
 			formatTimeAgo(time.Since(modTime)))
 
-		// Add file type info if possible
-		if ext := filepath.Ext(path); ext != "" {
-			fmt.Printf("Type: %s file\n", strings.TrimPrefix(ext, "."))
+		// Add file type info for regular files if possible, preferring the
+		// sniffed type. Opening a FIFO or device could block.
+		if err == nil && info.Mode().IsRegular() {
+			if contentType, err := fileutils.DetectContentType(path); err == nil {
+				fmt.Printf("Type: %s\n", contentType)
+			} else if ext := filepath.Ext(path); ext != "" {
+				fmt.Printf("Type: %s file\n", strings.TrimPrefix(ext, "."))
+			}
 		}
 
 		fmt.Printf("%s\n", strings.Repeat("-", 80))
-		fmt.Print("Actions: [d]elete, [s]kip, [q]uit: ")
+		fmt.Printf("Actions: %s, [s]kip, [q]uit: ", messages.prompt)
 
 		var response string
 		fmt.Scanln(&response)
@@ -245,8 +395,9 @@ func handleOldFile(mode string, path string, fileSize int64, modTime time.Time,
 
 		switch response {
 		case "d":
-			deleteFile(path, tempFile)
-			fmt.Printf("✓ Deleted: %s\n", path)
+			if err := removeFile(config, path, tempFile); err == nil {
+				fmt.Printf("✓ %s: %s\n", messages.done, path)
+			}
 		case "q":
 			fmt.Println("\nExiting interactive mode...")
 			os.Exit(0)
@@ -256,27 +407,83 @@ func handleOldFile(mode string, path string, fileSize int64, modTime time.Time,
 			fmt.Printf("→ Skipped: %s\n", path)
 		}
 	case "scheduled":
-		logging.LogMessage("INFO", fmt.Sprintf("Deleting file: %s (size: %s, modified: %s)",
-			path, fileutils.FormatSize(fileSize), modTime.Format("2006-01-02")))
-		deleteFile(path, tempFile)
+		logging.LogMessage("INFO", fmt.Sprintf("%s: %s (size: %s, modified: %s)",
+			messages.doing, path, fileutils.FormatSize(fileSize), modTime.Format("2006-01-02")))
+		removeFile(config, path, tempFile)
 	default:
 		logging.LogMessage("WARN", fmt.Sprintf("Unknown mode: %s, defaulting to dry-run", mode))
-		logging.LogMessage("INFO", fmt.Sprintf("Would delete file: %s (size: %s, modified: %s)",
-			path, fileutils.FormatSize(fileSize), modTime.Format("2006-01-02")))
+		logging.LogMessage("INFO", fmt.Sprintf("%s: %s (size: %s, modified: %s)",
+			messages.would, path, fileutils.FormatSize(fileSize), modTime.Format("2006-01-02")))
 		fmt.Fprintln(tempFile, path)
 	}
 }
 
-func deleteFile(path string, tempFile *os.File) {
+// actionMessages holds the wording used to report a rule's action
+type actionMessages struct {
+	would  string // dry-run
+	doing  string // scheduled
+	done   string // interactive confirmation
+	prompt string // interactive choice
+}
+
+func messagesFor(action string) actionMessages {
+	switch action {
+	case "trash":
+		return actionMessages{"Would move file to trash", "Moving file to trash", "Moved to trash", "[d] move to trash"}
+	case "quarantine":
+		return actionMessages{"Would quarantine file", "Quarantining file", "Quarantined", "[d] quarantine"}
+	case "compress":
+		return actionMessages{"Would compress file", "Compressing file", "Compressed", "[d] compress"}
+	case "archive":
+		return actionMessages{"Would archive file", "Archiving file", "Queued for archive", "[d] archive"}
+	default:
+		return actionMessages{"Would delete file", "Deleting file", "Deleted", "[d]elete"}
+	}
+}
+
+// removeFile gets rid of a candidate file according to the rule's action.
+// Broken symlinks and empty directories are always deleted directly.
+func removeFile(config config.Config, path string, tempFile *os.File) error {
+	switch config.GetAction() {
+	case "trash":
+		return trashFile(path, tempFile)
+	case "quarantine":
+		return quarantineFile(config, path, tempFile)
+	case "compress":
+		return compressFile(config, path, tempFile)
+	case "archive":
+		archiveQueue[config.Name] = append(archiveQueue[config.Name], path)
+		return nil
+	default:
+		return deleteFile(path, tempFile)
+	}
+}
+
+func trashFile(path string, tempFile *os.File) error {
+	target, err := trash.Trash(path)
+	if err != nil {
+		logging.LogMessage("ERROR", fmt.Sprintf("Error moving file %s to trash: %v", path, err))
+		return err
+	}
+	logging.LogMessage("INFO", fmt.Sprintf("Moved file to trash: %s -> %s", path, target))
+	// Write to temp file for summary
+	if _, err := fmt.Fprintln(tempFile, path); err != nil {
+		logging.LogMessage("ERROR", fmt.Sprintf("Error writing to temp file: %v", err))
+	}
+	return nil
+}
+
+func deleteFile(path string, tempFile *os.File) error {
 	if err := os.Remove(path); err != nil {
 		logging.LogMessage("ERROR", fmt.Sprintf("Error deleting file %s: %v", path, err))
-	} else {
-		logging.LogMessage("INFO", fmt.Sprintf("Deleted file: %s", path))
-		// Write to temp file for summary
-		if _, err := fmt.Fprintln(tempFile, path); err != nil {
-			logging.LogMessage("ERROR", fmt.Sprintf("Error writing to temp file: %v", err))
-		}
+		return err
 	}
+	logging.LogMessage("INFO", fmt.Sprintf("Deleted file: %s", path))
+	// Write to temp file for summary
+	if _, err := fmt.Fprintln(tempFile, path); err != nil {
+		logging.LogMessage("ERROR", fmt.Sprintf("Error writing to temp file: %v", err))
+	}
+	return nil
 }
 
 // formatTimeAgo returns a human-readable string representing how long ago a time was
@@ -303,55 +510,124 @@ func formatTimeAgo(duration time.Duration) string {
 }
 
 // Helper function to process a single path
-func processPath(path string, info os.FileInfo, config config.Config, tempFile *os.File, days int, minBytes, maxBytes int64) error {
-	// Handle recursive patterns ("**")
-	if strings.Contains(path, "**") {
-		// Find the base directory (everything before **)
-		parts := strings.Split(path, "**")
-		baseDir := parts[0]
+func processPath(state *ruleState, path string, root string, info os.FileInfo, config config.Config, tempFile *os.File, age time.Duration, minBytes, maxBytes int64) error {
+	if info.IsDir() {
+		// Git's own files are never cleaned
+		if config.ShouldOnlyCleanGitIgnored() && info.Name() == ignore.GitDirName {
+			return filepath.SkipDir
+		}
+		return nil
+	}
 
-		// Remove trailing slash if present
-		baseDir = strings.TrimRight(baseDir, "/\\")
+	if isExcluded(path, root, info, config.Exclude) {
+		return nil
+	}
 
-		// Get the remaining pattern after **
-		remainingPattern := ""
-		if len(parts) > 1 {
-			remainingPattern = parts[1]
+	return processFile(state, path, info, config, tempFile, age, minBytes, maxBytes)
+}
+
+// isExcluded reports whether path matches one of the exclude patterns.
+// Patterns without a separator are matched against the base name, absolute
+// patterns against the full path and all others against the path relative to
+// root. A trailing "/" restricts the pattern to directories.
+func isExcluded(path string, root string, info os.FileInfo, patterns []string) bool {
+	if len(patterns) == 0 || filepath.Clean(path) == filepath.Clean(root) {
+		return false
+	}
+
+	relPath, err := filepath.Rel(root, path)
+	if err != nil {
+		relPath = path
+	}
+	relPath = filepath.ToSlash(relPath)
+	name := filepath.Base(path)
+
+	for _, pattern := range patterns {
+		dirOnly := strings.HasSuffix(pattern, "/")
+		pattern = strings.TrimSuffix(filepath.ToSlash(pattern), "/")
+		if dirOnly && !info.IsDir() {
+			continue
 		}
 
-		return filepath.Walk(baseDir, func(subPath string, subInfo os.FileInfo, err error) error {
-			if err != nil {
-				logging.LogMessage("ERROR", fmt.Sprintf("Error accessing %s: %v", subPath, err))
-				return filepath.SkipDir
-			}
+		target := relPath
+		if !strings.Contains(pattern, "/") {
+			target = name
+		} else if strings.HasPrefix(pattern, "/") {
+			target = filepath.ToSlash(path)
+		}
 
-			// If there's a remaining pattern, check if the path matches
-			if remainingPattern != "" {
-				relPath := strings.TrimPrefix(subPath, baseDir)
-				matched, err := filepath.Match(remainingPattern, relPath)
-				if err != nil || !matched {
-					return nil
-				}
-			}
+		matched, err := glob.Match(pattern, target)
+		if err != nil {
+			logging.LogMessage("ERROR", fmt.Sprintf("Invalid exclude pattern %s: %v", pattern, err))
+			continue
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
 
-			if !subInfo.IsDir() {
-				return processFile(subPath, subInfo, config, tempFile, days, minBytes, maxBytes)
-			}
-			return nil
-		})
+// skipFunc returns the walkSkip leaving out the paths a rule excludes or
+// protects
+func (state *ruleState) skipFunc(config config.Config) walkSkip {
+	return func(path string, root string, info os.FileInfo) bool {
+		return isExcluded(path, root, info, config.Exclude) || state.protected.skips(path, info)
 	}
+}
 
+// skipExcluded logs an excluded path and prunes it from the walk if it is a directory
+func skipExcluded(path string, info os.FileInfo) error {
 	if info.IsDir() {
-		return nil
+		logging.LogMessage("DEBUG", fmt.Sprintf("Skipping excluded directory: %s", path))
+		return filepath.SkipDir
 	}
+	logging.LogMessage("DEBUG", fmt.Sprintf("Skipping excluded file: %s", path))
+	return nil
+}
 
-	return processFile(path, info, config, tempFile, days, minBytes, maxBytes)
+// matchesRegex reports whether a file passes the rule's name_regex,
+// path_regex and their exclude lists. Names are the base name, paths use
+// forward slashes on every platform.
+func matchesRegex(rule config.Config, path string) bool {
+	name := filepath.Base(path)
+	slashPath := filepath.ToSlash(path)
+
+	if config.MatchAny(rule.ExcludeNameRegex, name) || config.MatchAny(rule.ExcludePathRegex, slashPath) {
+		logging.LogMessage("DEBUG", fmt.Sprintf("Skipping file excluded by regex: %s", path))
+		return false
+	}
+	if len(rule.NameRegex) > 0 && !config.MatchAny(rule.NameRegex, name) {
+		return false
+	}
+	if len(rule.PathRegex) > 0 && !config.MatchAny(rule.PathRegex, slashPath) {
+		return false
+	}
+	return true
+}
+
+// sizeLimits converts the rule's file size limits to bytes, 0 meaning none
+func sizeLimits(config config.Config) (minBytes, maxBytes int64) {
+	if config.MinFileSize != nil {
+		minBytes = config.MinFileSize.ToBytes()
+	}
+	if config.MaxFileSize != nil {
+		maxBytes = config.MaxFileSize.ToBytes()
+	}
+	return minBytes, maxBytes
 }
 
 // New helper function to handle individual file processing
-func processFile(path string, info os.FileInfo, config config.Config, tempFile *os.File, days int, minBytes, maxBytes int64) error {
+func processFile(state *ruleState, path string, info os.FileInfo, config config.Config, tempFile *os.File, age time.Duration, minBytes, maxBytes int64) error {
+	if !matchesRegex(config, path) {
+		return nil
+	}
+	if config.ShouldOnlyCleanGitIgnored() && !state.gitIgnored(path, false) {
+		return nil
+	}
+
 	// Check for broken symlinks first if enabled
-	if config.CleanBrokenSymlinks {
+	if config.ShouldCleanBrokenSymlinks() {
 		linkInfo, err := os.Lstat(path)
 		if err == nil && linkInfo.Mode()&os.ModeSymlink != 0 {
 			target, err := os.Readlink(path)
@@ -360,13 +636,30 @@ func processFile(path string, info os.FileInfo, config config.Config, tempFile *
 					target = filepath.Join(filepath.Dir(path), target)
 				}
 				if _, err := os.Stat(target); os.IsNotExist(err) {
-					handleBrokenSymlink(config.Mode, path, tempFile)
+					// Owner and permission filters apply to the link itself
+					if state.owners.matches(linkInfo) {
+						handleBrokenSymlink(config, path, tempFile)
+					}
 					return nil
 				}
 			}
 		}
 	}
 
+	if !state.owners.matches(info) {
+		return nil
+	}
+
+	// A quota counts every file, including those that are not eligible
+	if config.HasQuota() {
+		state.usedBytes += info.Size()
+	}
+
+	// Compressing a file that is already compressed would not save anything
+	if config.GetAction() == "compress" && fileutils.IsCompressed(path) {
+		return nil
+	}
+
 	// Process regular files
 	fileSize := info.Size()
 	if (minBytes > 0 && fileSize < minBytes) ||
@@ -374,32 +667,61 @@ func processFile(path string, info os.FileInfo, config config.Config, tempFile *
 		return nil
 	}
 
-	modTime := info.ModTime()
-	cutoff := time.Now().AddDate(0, 0, -days)
-	if modTime.Before(cutoff) {
-		handleOldFile(config.Mode, path, fileSize, modTime, tempFile)
+	modTime := state.ageTime(config, path, info)
+	isOld := modTime.Before(time.Now().Add(-age))
+
+	// Young files only matter to retention, a free space target or a
+	// quota, which rank them too
+	if !isOld && !selectsCandidates(config) {
+		return nil
 	}
-	return nil
-}
 
-func cleanEmptyDirs(dir string, mode string, tempFile *os.File) {
-	// Walk the directory tree bottom-up
-	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			logging.LogMessage("ERROR", fmt.Sprintf("Error accessing %s: %v", path, err))
-			return nil
-		}
+	// Detecting the content type reads the file, so it is left until all
+	// other filters passed
+	if !matchesContentType(config, path, info) {
+		return nil
+	}
 
-		// Skip the root directory itself
-		if path == dir {
-			return nil
+	// Duplicates are found once all old files are known. Only regular
+	// files are compared, as a symlink would be hashed as its target.
+	if config.Dedupe != "" {
+		if info.Mode().IsRegular() {
+			state.dupeFiles = append(state.dupeFiles, dupes.NewFile(path, info))
 		}
+		return nil
+	}
+
+	// Files for retention, a free space target or a quota are picked once
+	// all are known
+	if selectsCandidates(config) {
+		state.addCandidate(path, info, modTime, isOld)
+		return nil
+	}
+	handleOldFile(config, path, fileSize, modTime,
+		fmt.Sprintf("older than %s (modified %s)", cfgDuration(age), modTime.Format("2006-01-02")), tempFile)
+	return nil
+}
 
+func cleanEmptyDirs(state *ruleState, dir string, config config.Config, tempFile *os.File) {
+	mode := config.Mode
+	// Excluded and protected directories are never entered or removed
+	walkPattern(dir, state.skipFunc(config), func(path string, root string, info os.FileInfo) error {
 		// Only process directories
 		if !info.IsDir() {
 			return nil
 		}
 
+		// With only_git_ignored, .git is never entered and only directories
+		// git ignores are removed
+		if config.ShouldOnlyCleanGitIgnored() {
+			if info.Name() == ignore.GitDirName {
+				return filepath.SkipDir
+			}
+			if !state.gitIgnored(path, true) {
+				return nil
+			}
+		}
+
 		// Check if directory is empty
 		entries, err := os.ReadDir(path)
 		if err != nil {
@@ -411,9 +733,11 @@ func cleanEmptyDirs(dir string, mode string, tempFile *os.File) {
 			switch mode {
 			case "analyze":
 				logging.LogMessage("INFO", fmt.Sprintf("Found empty directory: %s", path))
+			case "plan":
+				recordPlanEntry(path, plan.KindEmptyDir, config.Name, "empty directory", "delete")
 			case "dry-run":
 				logging.LogMessage("INFO", fmt.Sprintf("Would remove empty directory: %s", path))
-				fmt.Fprintln(tempFile, "EMPTY_DIR:"+path)
+				fmt.Fprintln(tempFile, fileutils.EmptyDirPrefix+path)
 			case "interactive":
 				fmt.Printf("Remove empty directory %s? (y/n): ", path)
 				var response string
@@ -426,7 +750,7 @@ func cleanEmptyDirs(dir string, mode string, tempFile *os.File) {
 			default:
 				logging.LogMessage("WARN", fmt.Sprintf("Unknown mode: %s, defaulting to dry-run", mode))
 				logging.LogMessage("INFO", fmt.Sprintf("Would remove empty directory: %s", path))
-				fmt.Fprintln(tempFile, "EMPTY_DIR:"+path)
+				fmt.Fprintln(tempFile, fileutils.EmptyDirPrefix+path)
 			}
 		}
 
@@ -434,14 +758,203 @@ func cleanEmptyDirs(dir string, mode string, tempFile *os.File) {
 	})
 }
 
-func deleteEmptyDir(path string, tempFile *os.File) {
+func deleteEmptyDir(path string, tempFile *os.File) error {
 	if err := os.Remove(path); err != nil {
 		logging.LogMessage("ERROR", fmt.Sprintf("Error removing directory %s: %v", path, err))
-	} else {
-		logging.LogMessage("INFO", fmt.Sprintf("Removed empty directory: %s", path))
-		// Write to temp file for summary
-		if _, err := fmt.Fprintln(tempFile, "EMPTY_DIR:"+path); err != nil {
-			logging.LogMessage("ERROR", fmt.Sprintf("Error writing to temp file: %v", err))
+		return err
+	}
+	logging.LogMessage("INFO", fmt.Sprintf("Removed empty directory: %s", path))
+	// Write to temp file for summary
+	if _, err := fmt.Fprintln(tempFile, fileutils.EmptyDirPrefix+path); err != nil {
+		logging.LogMessage("ERROR", fmt.Sprintf("Error writing to temp file: %v", err))
+	}
+	return nil
+}
+
+func quarantineFile(config config.Config, path string, tempFile *os.File) error {
+	if config.QuarantineDir == "" {
+		err := fmt.Errorf("quarantine_dir is not set for rule %s", config.Name)
+		logging.LogMessage("ERROR", fmt.Sprintf("Error quarantining file %s: %v", path, err))
+		return err
+	}
+	entry, err := quarantine.Move(config.QuarantineDir, runID, config.Name, path)
+	if err != nil {
+		logging.LogMessage("ERROR", fmt.Sprintf("Error quarantining file %s: %v", path, err))
+		return err
+	}
+	logging.LogMessage("INFO", fmt.Sprintf("Quarantined file: %s -> %s",
+		path, filepath.Join(config.QuarantineDir, entry.StoredPath)))
+	// Write to temp file for summary
+	if _, err := fmt.Fprintln(tempFile, path); err != nil {
+		logging.LogMessage("ERROR", fmt.Sprintf("Error writing to temp file: %v", err))
+	}
+	return nil
+}
+
+func compressFile(config config.Config, path string, tempFile *os.File) error {
+	target, saved, err := fileutils.CompressFile(path, config.GetCompression())
+	if errors.Is(err, fileutils.ErrNotSmaller) {
+		logging.LogMessage("INFO", fmt.Sprintf("Keeping %s uncompressed, it would not get smaller", path))
+		return err
+	}
+	if err != nil {
+		logging.LogMessage("ERROR", fmt.Sprintf("Error compressing file %s: %v", path, err))
+		return err
+	}
+	logging.LogMessage("INFO", fmt.Sprintf("Compressed file: %s -> %s (saved %s)",
+		path, target, fileutils.FormatSize(saved)))
+	// Write to temp file for summary, including the bytes saved
+	if _, err := fmt.Fprintf(tempFile, "%s%d:%s\n", fileutils.CompressedPrefix, saved, path); err != nil {
+		logging.LogMessage("ERROR", fmt.Sprintf("Error writing to temp file: %v", err))
+	}
+	return nil
+}
+
+// flushArchive writes the files queued for the rule into a new archive in
+// archive_dir, verifies it, and then deletes the originals. Files that
+// changed while being archived are kept. It returns how many queued files
+// were not deleted.
+func flushArchive(config config.Config, tempFile *os.File) int {
+	paths := archiveQueue[config.Name]
+	delete(archiveQueue, config.Name)
+	if len(paths) == 0 {
+		return 0
+	}
+
+	target, entries, err := archive.Create(config.ArchiveDir, config.Name, config.GetCompression(), paths)
+	if err != nil {
+		logging.LogMessage("ERROR", fmt.Sprintf("Error archiving files of rule %s: %v", config.Name, err))
+	}
+	if target == "" {
+		return len(paths)
+	}
+	logging.LogMessage("INFO", fmt.Sprintf("Archived %d files to %s", len(entries), target))
+
+	deleted := 0
+	for _, entry := range entries {
+		if err := entry.Unchanged(); err != nil {
+			logging.LogMessage("WARN", fmt.Sprintf("Keeping %s: %v", entry.OriginalPath, err))
+			continue
+		}
+		if deleteFile(entry.OriginalPath, tempFile) == nil {
+			deleted++
+		}
+	}
+	return len(paths) - deleted
+}
+
+// purgeQuarantine permanently removes files quarantined more than
+// quarantine_days ago. Only scheduled runs purge; other modes report.
+func purgeQuarantine(config config.Config) {
+	if _, err := os.Stat(config.QuarantineDir); os.IsNotExist(err) {
+		return
+	}
+
+	maxAge := time.Duration(config.GetQuarantineDays()) * 24 * time.Hour
+	dryRun := config.Mode != "scheduled"
+	purged, err := quarantine.Purge(config.QuarantineDir, maxAge, dryRun)
+	if err != nil {
+		logging.LogMessage("ERROR", fmt.Sprintf("Error purging quarantine %s: %v", config.QuarantineDir, err))
+	}
+	for _, entry := range purged {
+		if dryRun {
+			logging.LogMessage("INFO", fmt.Sprintf("Would purge quarantined file: %s (quarantined %s)",
+				entry.OriginalPath, entry.QuarantinedAt.Format("2006-01-02")))
+		} else {
+			logging.LogMessage("INFO", fmt.Sprintf("Purged quarantined file: %s (quarantined %s)",
+				entry.OriginalPath, entry.QuarantinedAt.Format("2006-01-02")))
 		}
 	}
 }
+
+// recordPlanEntry adds a candidate to the active plan
+func recordPlanEntry(path, kind, rule, reason, action string) {
+	if activePlan == nil {
+		logging.LogMessage("ERROR", fmt.Sprintf("No plan to record %s in", path))
+		return
+	}
+	if err := activePlan.Add(path, kind, rule, reason, action); err != nil {
+		logging.LogMessage("ERROR", fmt.Sprintf("Error adding %s to plan: %v", path, err))
+		return
+	}
+	logging.LogMessage("INFO", fmt.Sprintf("Planned %s: %s (%s)", strings.ReplaceAll(kind, "_", " "), path, reason))
+}
+
+// appliedVerb names what applying a plan entry with an action did to it
+func appliedVerb(action string) string {
+	switch action {
+	case "trash":
+		return "trashed"
+	case "quarantine":
+		return "quarantined"
+	case "compress":
+		return "compressed"
+	case "archive":
+		return "archived"
+	case "hardlink":
+		return "replaced with hard links"
+	case "reflink":
+		return "replaced with reflinks"
+	default:
+		return "deleted"
+	}
+}
+
+// ApplyPlan carries out exactly the entries of a plan. Each entry is checked
+// against what was recorded when the plan was made and skipped if it changed
+// in the meantime. Entries are applied in order, so empty directories planned
+// after their contents are removed last. rules maps rule names to their
+// configs, which supply settings such as quarantine_dir for the planned
+// action. applied counts the entries by what was done to them, such as
+// "deleted" or "trashed".
+func ApplyPlan(p *plan.Plan, rules map[string]config.Config, tempFile *os.File) (applied map[string]int, skipped, failed int) {
+	applied = make(map[string]int)
+	for _, entry := range p.Entries {
+		if err := entry.Verify(); err != nil {
+			logging.LogMessage("WARN", fmt.Sprintf("Skipping %s: %v", entry.Path, err))
+			skipped++
+			continue
+		}
+
+		var err error
+		action := entry.Action
+		switch entry.Kind {
+		case plan.KindEmptyDir:
+			action = "delete"
+			err = deleteEmptyDir(entry.Path, tempFile)
+		case plan.KindBrokenSymlink:
+			action = "delete"
+			err = deleteFile(entry.Path, tempFile)
+		case plan.KindDuplicate:
+			err = applyPlannedDuplicate(entry, tempFile)
+		case plan.KindDirectory:
+			rule := rules[entry.Rule]
+			rule.Action = entry.Action
+			err = removeDirectory(rule, entry.Path, entry.Size, tempFile)
+		default:
+			rule := rules[entry.Rule]
+			rule.Name = entry.Rule
+			rule.Action = entry.Action
+			err = removeFile(rule, entry.Path, tempFile)
+		}
+		if errors.Is(err, fileutils.ErrNotSmaller) {
+			applied["left uncompressed"]++
+			continue
+		}
+		if err != nil {
+			failed++
+			continue
+		}
+		applied[appliedVerb(action)]++
+	}
+
+	// Entries with action archive were only queued above
+	for name := range archiveQueue {
+		rule := rules[name]
+		rule.Name = name
+		n := flushArchive(rule, tempFile)
+		applied[appliedVerb("archive")] -= n
+		failed += n
+	}
+	return applied, skipped, failed
+}
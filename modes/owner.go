@@ -0,0 +1,117 @@
+package modes
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+
+	"github.com/arkag/dirclean/config"
+	"github.com/arkag/dirclean/fileutils"
+)
+
+// ownerFilter holds a rule's owner, group and permission filters with names
+// resolved to numeric IDs
+type ownerFilter struct {
+	owners         map[int]bool
+	excludedOwners map[int]bool
+	groups         map[int]bool
+	uidMin, uidMax int
+	hasUIDRange    bool
+	perm           *config.PermFilter
+}
+
+// newOwnerFilter resolves a rule's filters. It returns nil if the rule has
+// no owner, group or permission filters.
+func newOwnerFilter(rule config.Config) (*ownerFilter, error) {
+	if len(rule.Owner) == 0 && len(rule.ExcludeOwner) == 0 && len(rule.Group) == 0 &&
+		rule.UIDRange == "" && rule.Perm == "" {
+		return nil, nil
+	}
+
+	filter := &ownerFilter{}
+	var err error
+	if filter.owners, err = lookupIDs(rule.Owner, config.LookupUID); err != nil {
+		return nil, err
+	}
+	if filter.excludedOwners, err = lookupIDs(rule.ExcludeOwner, config.LookupUID); err != nil {
+		return nil, err
+	}
+	if filter.groups, err = lookupIDs(rule.Group, config.LookupGID); err != nil {
+		return nil, err
+	}
+	if rule.UIDRange != "" {
+		if filter.uidMin, filter.uidMax, err = config.ParseUIDRange(rule.UIDRange); err != nil {
+			return nil, err
+		}
+		filter.hasUIDRange = true
+	}
+	if rule.Perm != "" {
+		perm, err := config.ParsePerm(rule.Perm)
+		if err != nil {
+			return nil, err
+		}
+		filter.perm = &perm
+	}
+	return filter, nil
+}
+
+// matches reports whether a file passes the filter. Files whose owner
+// cannot be determined never pass owner, group or uid_range filters.
+func (f *ownerFilter) matches(info os.FileInfo) bool {
+	if f == nil {
+		return true
+	}
+	if f.perm != nil && !f.perm.Matches(info.Mode()) {
+		return false
+	}
+	if len(f.owners) == 0 && len(f.excludedOwners) == 0 && len(f.groups) == 0 && !f.hasUIDRange {
+		return true
+	}
+
+	uid, gid, ok := fileutils.FileOwner(info)
+	if !ok {
+		return false
+	}
+	if len(f.owners) > 0 && !f.owners[uid] {
+		return false
+	}
+	if f.excludedOwners[uid] {
+		return false
+	}
+	if len(f.groups) > 0 && !f.groups[gid] {
+		return false
+	}
+	if f.hasUIDRange && (uid < f.uidMin || uid > f.uidMax) {
+		return false
+	}
+	return true
+}
+
+func lookupIDs(names []string, lookup func(string) (int, error)) (map[int]bool, error) {
+	ids := make(map[int]bool)
+	for _, name := range names {
+		id, err := lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, nil
+}
+
+// ownerName describes who owns a file, as "name:group (uid:gid)"
+func ownerName(info os.FileInfo) (string, bool) {
+	uid, gid, ok := fileutils.FileOwner(info)
+	if !ok {
+		return "", false
+	}
+	userName, groupName := strconv.Itoa(uid), strconv.Itoa(gid)
+	if u, err := user.LookupId(userName); err == nil {
+		userName = u.Username
+	}
+	if g, err := user.LookupGroupId(groupName); err == nil {
+		groupName = g.Name
+	}
+	return fmt.Sprintf("%s:%s (%d:%d)", userName, groupName, uid, gid), true
+}
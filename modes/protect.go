@@ -0,0 +1,71 @@
+package modes
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/arkag/dirclean/ignore"
+	"github.com/arkag/dirclean/logging"
+)
+
+// Marker files that let the owners of a directory protect their files
+// without editing the config: a .dircleanignore holds gitignore patterns
+// relative to its directory, a .dirclean-keep protects its whole directory
+const (
+	ignoreFileName = ".dircleanignore"
+	keepFileName   = ".dirclean-keep"
+)
+
+// protection holds the marker file trees of the roots walked by the current
+// rule
+type protection struct {
+	roots []string
+	trees map[string]*ignore.Tree
+}
+
+func newProtection(roots []string) *protection {
+	p := &protection{trees: make(map[string]*ignore.Tree)}
+	for _, root := range roots {
+		root = filepath.Clean(root)
+		if _, ok := p.trees[root]; ok {
+			continue
+		}
+		p.roots = append(p.roots, root)
+		p.trees[root] = ignore.NewTree(root, []string{ignoreFileName}, keepFileName)
+	}
+	return p
+}
+
+// skips reports whether a path is protected by a marker file. The marker
+// files themselves are always protected.
+func (p *protection) skips(path string, info os.FileInfo) bool {
+	if p == nil {
+		return false
+	}
+	if name := info.Name(); !info.IsDir() && (name == ignoreFileName || name == keepFileName) {
+		return true
+	}
+	tree := p.treeFor(path)
+	if tree == nil || !tree.Ignored(path, info.IsDir()) {
+		return false
+	}
+	logging.LogMessage("DEBUG", fmt.Sprintf("Skipping path protected by %s or %s: %s", ignoreFileName, keepFileName, path))
+	return true
+}
+
+// treeFor returns the tree of the innermost root containing path
+func (p *protection) treeFor(path string) *ignore.Tree {
+	var best string
+	for _, root := range p.roots {
+		if (path == root || strings.HasPrefix(path, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator))) &&
+			len(root) > len(best) {
+			best = root
+		}
+	}
+	if best == "" {
+		return nil
+	}
+	return p.trees[best]
+}
@@ -0,0 +1,56 @@
+package modes
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/arkag/dirclean/config"
+	"github.com/arkag/dirclean/fileutils"
+	"github.com/arkag/dirclean/logging"
+)
+
+// selectForQuota picks the least recently used candidates until the rule's
+// files fit in max_total_size, and returns them along with the candidates
+// it left alone. usedBytes is the size of all of the rule's files. A file was last used when it was last read or modified,
+// whichever is later.
+func selectForQuota(config config.Config, files []candidate, usedBytes int64) (selected, remaining []candidate) {
+	quota := config.MaxTotalSize.ToBytes()
+	if usedBytes <= quota {
+		logging.LogMessage("INFO", fmt.Sprintf("Rule %s uses %s of its %s quota",
+			config.Name, fileutils.FormatSize(usedBytes), fileutils.FormatSize(quota)))
+		if config.Mode == "analyze" {
+			fmt.Printf("\nRule %s: %s used, within quota of %s\n",
+				config.Name, fileutils.FormatSize(usedBytes), fileutils.FormatSize(quota))
+		}
+		return nil, files
+	}
+
+	over := usedBytes - quota
+	logging.LogMessage("INFO", fmt.Sprintf("Rule %s uses %s, %s over its %s quota",
+		config.Name, fileutils.FormatSize(usedBytes), fileutils.FormatSize(over), fileutils.FormatSize(quota)))
+	if config.Mode == "analyze" {
+		fmt.Printf("\nRule %s: %s used, %s over quota of %s\n",
+			config.Name, fileutils.FormatSize(usedBytes), fileutils.FormatSize(over), fileutils.FormatSize(quota))
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].lastUsed.Before(files[j].lastUsed)
+	})
+
+	var freed int64
+	for i, file := range files {
+		if freed >= over {
+			return selected, files[i:]
+		}
+		file.reason = fmt.Sprintf("least recently used to stay under %s quota (last used %s)",
+			fileutils.FormatSize(quota), file.lastUsed.Format("2006-01-02"))
+		selected = append(selected, file)
+		freed += file.size
+	}
+
+	if freed < over {
+		logging.LogMessage("WARN", fmt.Sprintf("Rule %s cannot get under its quota, eligible files only free %s of %s",
+			config.Name, fileutils.FormatSize(freed), fileutils.FormatSize(over)))
+	}
+	return selected, nil
+}
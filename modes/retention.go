@@ -0,0 +1,172 @@
+package modes
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arkag/dirclean/config"
+	"github.com/arkag/dirclean/fileutils"
+	"github.com/arkag/dirclean/logging"
+)
+
+// selectByRetention groups files according to group_by and returns the
+// eligible files that neither keep_newest nor retention keeps in their
+// group. Files that do not match group_pattern are kept.
+func selectByRetention(config config.Config, files []candidate, dateParser *fileutils.DateParser) []candidate {
+	keep := config.GetKeepNewest()
+
+	var pattern *regexp.Regexp
+	if config.GetGroupBy() == "regex" {
+		var err error
+		if pattern, err = regexp.Compile(config.GroupPattern); err != nil {
+			logging.LogMessage("ERROR", fmt.Sprintf("Invalid group_pattern %s: %v", config.GroupPattern, err))
+			return nil
+		}
+	}
+
+	var keys []string
+	groups := make(map[string][]candidate)
+	for _, file := range files {
+		key, ok := groupKey(config.GetGroupBy(), pattern, file.path)
+		if !ok {
+			logging.LogMessage("DEBUG", fmt.Sprintf("Keeping %s: does not match group_pattern", file.path))
+			continue
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], file)
+	}
+
+	var selected []candidate
+	for _, key := range keys {
+		group := groups[key]
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].modTime.After(group[j].modTime)
+		})
+		kept := make(map[int]bool)
+		if config.HasKeepNewest() {
+			for i := 0; i < keep && i < len(group); i++ {
+				kept[i] = true
+			}
+		}
+		if config.HasRetention() {
+			keepPeriods(*config.Retention, group, kept, dateParser)
+		}
+
+		for i, file := range group {
+			if kept[i] || !file.eligible {
+				continue
+			}
+			file.reason = retentionReason(config, file)
+			selected = append(selected, file)
+		}
+	}
+	return selected
+}
+
+// periods maps each retention period to the calendar bucket a date falls in
+var periods = []struct {
+	name   string
+	count  func(config.Retention) *int
+	bucket func(time.Time) string
+}{
+	{"daily", func(r config.Retention) *int { return r.Daily }, func(t time.Time) string { return t.Format("2006-01-02") }},
+	{"weekly", func(r config.Retention) *int { return r.Weekly }, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	}},
+	{"monthly", func(r config.Retention) *int { return r.Monthly }, func(t time.Time) string { return t.Format("2006-01") }},
+	{"yearly", func(r config.Retention) *int { return r.Yearly }, func(t time.Time) string { return t.Format("2006") }},
+}
+
+// keepPeriods marks, for each period, the newest file in each of the most
+// recent buckets. group must be sorted newest first by modification time.
+func keepPeriods(retention config.Retention, group []candidate, kept map[int]bool, dateParser *fileutils.DateParser) {
+	order := make([]int, len(group))
+	dates := make([]time.Time, len(group))
+	for i, file := range group {
+		order[i] = i
+		dates[i] = retentionDate(retention, file, dateParser)
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return dates[order[a]].After(dates[order[b]])
+	})
+
+	for _, period := range periods {
+		count := config.Value(period.count(retention))
+		last := ""
+		for _, i := range order {
+			if count == 0 {
+				break
+			}
+			if bucket := period.bucket(dates[i]); bucket != last {
+				kept[i] = true
+				last = bucket
+				count--
+			}
+		}
+	}
+}
+
+// retentionDate returns the date retention buckets a file by, the time its
+// age is measured from unless the rule asks for a date from the file name
+func retentionDate(retention config.Retention, file candidate, dateParser *fileutils.DateParser) time.Time {
+	if retention.GetDate() == "filename" {
+		if date, ok := dateParser.Parse(filepath.Base(file.path)); ok {
+			return date
+		}
+	}
+	return file.modTime
+}
+
+func retentionReason(config config.Config, file candidate) string {
+	var policies []string
+	if config.HasKeepNewest() {
+		policies = append(policies, fmt.Sprintf("among the %d newest of its group", config.GetKeepNewest()))
+	}
+	if config.HasRetention() {
+		var counts []string
+		for _, period := range periods {
+			if count := period.count(*config.Retention); count != nil && *count > 0 {
+				counts = append(counts, fmt.Sprintf("%d %s", *count, period.name))
+			}
+		}
+		policies = append(policies, fmt.Sprintf("kept by retention (%s)", strings.Join(counts, ", ")))
+	}
+	return fmt.Sprintf("not %s (modified %s)", strings.Join(policies, " or "), file.modTime.Format("2006-01-02"))
+}
+
+// groupKey returns the retention group of a file. Groups never span
+// directories.
+func groupKey(groupBy string, pattern *regexp.Regexp, path string) (string, bool) {
+	dir, name := filepath.Split(path)
+	switch groupBy {
+	case "prefix":
+		return dir + "\x00" + namePrefix(name), true
+	case "regex":
+		match := pattern.FindStringSubmatch(name)
+		if match == nil {
+			return "", false
+		}
+		if len(match) > 1 {
+			match = match[1:]
+		}
+		return dir + "\x00" + strings.Join(match, "\x00"), true
+	default:
+		return dir, true
+	}
+}
+
+// namePrefix returns the part of a file name before its first digit, so that
+// release-1.2.3.tar.gz and release-1.3.0.tar.gz share the prefix "release-"
+func namePrefix(name string) string {
+	if i := strings.IndexAny(name, "0123456789"); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
@@ -0,0 +1,76 @@
+package modes
+
+import (
+	"os"
+	"time"
+
+	"github.com/arkag/dirclean/config"
+	"github.com/arkag/dirclean/fileutils"
+)
+
+// candidate is an eligible file held back until all of a rule's files are
+// known, for rules that pick a subset of them
+type candidate struct {
+	path     string
+	size     int64
+	modTime  time.Time // when the file's age is measured from
+	lastUsed time.Time
+	device   uint64
+	eligible bool // old enough to be removed
+	reason   string
+}
+
+// selectsCandidates reports whether a rule picks which eligible files to
+// remove instead of removing all of them
+func selectsCandidates(config config.Config) bool {
+	return config.HasKeepNewest() || config.HasRetention() || config.HasTarget() || config.HasQuota()
+}
+
+func (state *ruleState) addCandidate(path string, info os.FileInfo, modTime time.Time, eligible bool) {
+	file := candidate{
+		path:     path,
+		size:     info.Size(),
+		modTime:  modTime,
+		lastUsed: info.ModTime(),
+		eligible: eligible,
+	}
+	// Filesystems mounted noatime never advance atime past mtime
+	if atime, ok := fileutils.AccessTime(info); ok && atime.After(file.lastUsed) {
+		file.lastUsed = atime
+	}
+	file.device, _, _ = fileutils.FileID(info)
+	state.candidates = append(state.candidates, file)
+}
+
+// selectCandidates applies the rule's retention to the collected files and
+// then its quota and free space target to the eligible files retention does
+// not keep. Without a quota or target, all of those are selected. Space
+// freed for the quota counts towards the target.
+func (state *ruleState) selectCandidates(config config.Config) []candidate {
+	var remaining []candidate
+	if config.HasKeepNewest() || config.HasRetention() {
+		remaining = selectByRetention(config, state.candidates, state.dateParser)
+	} else {
+		for _, file := range state.candidates {
+			if file.eligible {
+				remaining = append(remaining, file)
+			}
+		}
+	}
+	if !config.HasQuota() && !config.HasTarget() {
+		return remaining
+	}
+
+	var selected []candidate
+	if config.HasQuota() {
+		selected, remaining = selectForQuota(config, remaining, state.usedBytes)
+	}
+	if config.HasTarget() {
+		freed := make(map[uint64]int64)
+		for _, file := range selected {
+			freed[file.device] += file.size
+		}
+		selected = append(selected, selectForTarget(config, remaining, freed)...)
+	}
+	return selected
+}
@@ -0,0 +1,49 @@
+package modes
+
+import (
+	"fmt"
+
+	"github.com/arkag/dirclean/config"
+	"github.com/arkag/dirclean/dupes"
+	"github.com/arkag/dirclean/fileutils"
+	"github.com/arkag/dirclean/ignore"
+)
+
+// ruleState is what processing one rule keeps track of besides its config.
+// ProcessFiles creates it for every rule and passes it along the walk.
+type ruleState struct {
+	dateParser       *fileutils.DateParser // extracts dates from file names
+	ageByUnavailable bool                  // set once the age_by fallback was reported
+	owners           *ownerFilter          // nil if the rule has no owner filters
+	protected        *protection           // marker files below the walked roots
+
+	// gitRepos holds the work trees found so far by root. A nil Repo could
+	// not be read and ignores nothing, so none of its files are cleaned.
+	// gitRoots memoizes the innermost work tree containing a directory, or
+	// "" for directories outside any work tree.
+	gitRepos map[string]*ignore.Repo
+	gitRoots map[string]string
+
+	candidates []candidate  // files for retention, a free space target or a quota
+	usedBytes  int64        // size of all files, eligible or not, for a quota
+	dupeFiles  []dupes.File // files for dedupe, grouped once all are known
+}
+
+// newRuleState resolves a rule's date pattern and owner filters and sets up
+// the marker files below the roots it walks
+func newRuleState(config config.Config, roots []string) (*ruleState, error) {
+	state := &ruleState{
+		protected: newProtection(roots),
+		gitRepos:  make(map[string]*ignore.Repo),
+		gitRoots:  make(map[string]string),
+	}
+
+	var err error
+	if state.dateParser, err = fileutils.NewDateParser(config.DatePattern, config.DateLayout); err != nil {
+		return nil, fmt.Errorf("invalid date_pattern %s: %v", config.DatePattern, err)
+	}
+	if state.owners, err = newOwnerFilter(config); err != nil {
+		return nil, fmt.Errorf("invalid owner filter: %v", err)
+	}
+	return state, nil
+}
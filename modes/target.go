@@ -0,0 +1,92 @@
+package modes
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/arkag/dirclean/config"
+	"github.com/arkag/dirclean/fileutils"
+	"github.com/arkag/dirclean/logging"
+)
+
+// selectForTarget picks, per filesystem, the candidates that have to go to
+// bring free space up to the rule's target. Filesystems that already meet
+// the target keep all their files. Freed space is estimated from file sizes,
+// starting from what was already freed on each device.
+func selectForTarget(config config.Config, files []candidate, freed map[uint64]int64) []candidate {
+	var devices []uint64
+	byDevice := make(map[uint64][]candidate)
+	for _, file := range files {
+		if _, ok := byDevice[file.device]; !ok {
+			devices = append(devices, file.device)
+		}
+		byDevice[file.device] = append(byDevice[file.device], file)
+	}
+
+	var selected []candidate
+	for _, device := range devices {
+		group := byDevice[device]
+		dir := filepath.Dir(group[0].path)
+		available, total, err := fileutils.GetDiskSpace(dir)
+		if err != nil {
+			logging.LogMessage("ERROR", fmt.Sprintf("Error getting free space for %s: %v", dir, err))
+			continue
+		}
+
+		available += uint64(freed[device])
+		target := targetBytes(config, total)
+		if available >= target {
+			logging.LogMessage("INFO", fmt.Sprintf("Filesystem of %s has %s free, target of %s is met",
+				dir, fileutils.FormatSize(int64(available)), fileutils.FormatSize(int64(target))))
+			continue
+		}
+		needed := int64(target - available)
+
+		sortCandidates(group, config.GetTargetOrder())
+		var freedHere int64
+		for _, file := range group {
+			if freedHere >= needed {
+				break
+			}
+			file.reason = fmt.Sprintf("%s file selected to reach free space target (modified %s)",
+				config.GetTargetOrder(), file.modTime.Format("2006-01-02"))
+			selected = append(selected, file)
+			freedHere += file.size
+		}
+
+		logging.LogMessage("INFO", fmt.Sprintf("Filesystem of %s has %s free, selecting %s of files to reach target of %s",
+			dir, fileutils.FormatSize(int64(available)), fileutils.FormatSize(freedHere), fileutils.FormatSize(int64(target))))
+		if freedHere < needed {
+			logging.LogMessage("WARN", fmt.Sprintf("Target for filesystem of %s cannot be reached, eligible files only free %s of %s needed",
+				dir, fileutils.FormatSize(freedHere), fileutils.FormatSize(needed)))
+		}
+	}
+	return selected
+}
+
+// targetBytes returns the free bytes a rule asks for on a filesystem of the
+// given size, the larger of target_free and target_free_bytes
+func targetBytes(config config.Config, total uint64) uint64 {
+	var target uint64
+	if config.TargetFree != nil {
+		target = uint64(float64(total) * float64(*config.TargetFree) / 100)
+	}
+	if config.TargetFreeBytes != nil {
+		if bytes := uint64(config.TargetFreeBytes.ToBytes()); bytes > target {
+			target = bytes
+		}
+	}
+	return target
+}
+
+// sortCandidates orders files oldest first, or largest first with order
+// "largest"
+func sortCandidates(files []candidate, order string) {
+	sort.SliceStable(files, func(i, j int) bool {
+		if order == "largest" && files[i].size != files[j].size {
+			return files[i].size > files[j].size
+		}
+		return files[i].modTime.Before(files[j].modTime)
+	})
+}
@@ -0,0 +1,207 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/arkag/dirclean/fileutils"
+)
+
+// Kinds of plan entries
+const (
+	KindFile          = "file"
+	KindBrokenSymlink = "broken_symlink"
+	KindEmptyDir      = "empty_dir"
+	// KindDirectory is a directory removed as a whole. Its size is that of
+	// everything below it and its mtime that of the newest file.
+	KindDirectory = "directory"
+	// KindDuplicate is a file with the same contents as Original
+	KindDuplicate = "duplicate"
+)
+
+// Entry is a single deletion candidate recorded by "dirclean plan"
+type Entry struct {
+	Path    string    `json:"path"`
+	Kind    string    `json:"kind"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Inode   uint64    `json:"inode,omitempty"`
+	Device  uint64    `json:"device,omitempty"`
+	Rule    string    `json:"rule"`
+	Reason  string    `json:"reason"`
+	Action  string    `json:"action,omitempty"`
+	// Original is the copy a duplicate is replaced with or deleted in
+	// favor of
+	Original string `json:"original,omitempty"`
+}
+
+// Plan is a reviewable list of deletion candidates
+type Plan struct {
+	RunID   string    `json:"run_id"`
+	Created time.Time `json:"created"`
+	Config  string    `json:"config,omitempty"`
+	Entries []Entry   `json:"entries"`
+}
+
+// New creates an empty plan for a run
+func New(runID, configFile string) *Plan {
+	return &Plan{
+		RunID:   runID,
+		Created: time.Now(),
+		Config:  configFile,
+		Entries: []Entry{},
+	}
+}
+
+// Add records path as a candidate. The file is stat'ed without following
+// symlinks so that apply can later detect whether it changed.
+func (p *Plan) Add(path, kind, rule, reason, action string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	entry := Entry{
+		Path:    path,
+		Kind:    kind,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Rule:    rule,
+		Reason:  reason,
+		Action:  action,
+	}
+	if device, inode, ok := fileutils.FileID(info); ok {
+		entry.Device = device
+		entry.Inode = inode
+	}
+	if kind == KindDirectory {
+		dirInfo, err := fileutils.GetDirInfo(path, nil)
+		if err != nil {
+			return err
+		}
+		entry.Size = dirInfo.Size
+		entry.ModTime = dirInfo.LastUsed
+	}
+	p.Entries = append(p.Entries, entry)
+	return nil
+}
+
+// AddDuplicate records path as a duplicate of original, to be deleted or
+// replaced with a link to it according to action
+func (p *Plan) AddDuplicate(path, original, rule, reason, action string) error {
+	if err := p.Add(path, KindDuplicate, rule, reason, action); err != nil {
+		return err
+	}
+	p.Entries[len(p.Entries)-1].Original = original
+	return nil
+}
+
+// TotalSize returns the combined size of all file entries
+func (p *Plan) TotalSize() int64 {
+	var total int64
+	for _, entry := range p.Entries {
+		if entry.Kind != KindEmptyDir {
+			total += entry.Size
+		}
+	}
+	return total
+}
+
+// Write encodes the plan as indented JSON
+func (p *Plan) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(p)
+}
+
+// Save writes the plan to a file
+func (p *Plan) Save(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("error creating plan file: %v", err)
+	}
+	defer f.Close()
+
+	if err := p.Write(f); err != nil {
+		return fmt.Errorf("error writing plan file: %v", err)
+	}
+	return f.Close()
+}
+
+// Load reads a plan previously written by Save
+func Load(path string) (*Plan, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening plan file: %v", err)
+	}
+	defer f.Close()
+
+	var p Plan
+	if err := json.NewDecoder(f).Decode(&p); err != nil {
+		return nil, fmt.Errorf("error decoding plan file: %v", err)
+	}
+	return &p, nil
+}
+
+// Verify checks that the file at the entry's path is still the one that was
+// planned: same inode and device where available, same size and mtime, for
+// empty directories, still empty, and for directories removed as a whole,
+// the same total size and newest file
+func (e Entry) Verify() error {
+	info, err := os.Lstat(e.Path)
+	if err != nil {
+		return err
+	}
+
+	if device, inode, ok := fileutils.FileID(info); ok && e.Inode != 0 {
+		if device != e.Device || inode != e.Inode {
+			return fmt.Errorf("file was replaced (inode %d on device %d, planned inode %d on device %d)",
+				inode, device, e.Inode, e.Device)
+		}
+	}
+
+	switch e.Kind {
+	case KindEmptyDir:
+		if !info.IsDir() {
+			return fmt.Errorf("no longer a directory")
+		}
+		entries, err := os.ReadDir(e.Path)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return fmt.Errorf("directory is no longer empty")
+		}
+		return nil
+	case KindDirectory:
+		if !info.IsDir() {
+			return fmt.Errorf("no longer a directory")
+		}
+		dirInfo, err := fileutils.GetDirInfo(e.Path, nil)
+		if err != nil {
+			return err
+		}
+		if dirInfo.Size != e.Size || !dirInfo.LastUsed.Equal(e.ModTime) {
+			return fmt.Errorf("directory contents changed since it was planned")
+		}
+		return nil
+	case KindBrokenSymlink:
+		if info.Mode()&os.ModeSymlink == 0 {
+			return fmt.Errorf("no longer a symlink")
+		}
+		if _, err := os.Stat(e.Path); err == nil {
+			return fmt.Errorf("symlink target exists again")
+		}
+	}
+
+	if info.Size() != e.Size {
+		return fmt.Errorf("size changed from %d to %d bytes", e.Size, info.Size())
+	}
+	if !info.ModTime().Equal(e.ModTime) {
+		return fmt.Errorf("modified at %s, planned at %s", info.ModTime().Format(time.RFC3339), e.ModTime.Format(time.RFC3339))
+	}
+	return nil
+}
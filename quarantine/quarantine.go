@@ -0,0 +1,316 @@
+package quarantine
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/arkag/dirclean/fileutils"
+)
+
+// ManifestName is the file in a quarantine root that lists every
+// quarantined file, one JSON object per line
+const ManifestName = "manifest.jsonl"
+
+// Entry describes a quarantined file and everything needed to restore it
+type Entry struct {
+	RunID         string      `json:"run_id"`
+	Rule          string      `json:"rule,omitempty"`
+	OriginalPath  string      `json:"original_path"`
+	StoredPath    string      `json:"stored_path"`
+	Size          int64       `json:"size"`
+	Mode          os.FileMode `json:"mode"`
+	UID           int         `json:"uid"`
+	GID           int         `json:"gid"`
+	HasOwner      bool        `json:"has_owner"`
+	ModTime       time.Time   `json:"mtime"`
+	QuarantinedAt time.Time   `json:"quarantined_at"`
+}
+
+// Move moves path into root/<runID>/<original path> and appends an entry
+// for it to the root's manifest
+func Move(root, runID, rule, path string) (Entry, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return Entry{}, err
+	}
+	info, err := os.Lstat(absPath)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	entry := Entry{
+		RunID:         runID,
+		Rule:          rule,
+		OriginalPath:  absPath,
+		StoredPath:    filepath.Join(runID, relativeToVolume(absPath)),
+		Size:          info.Size(),
+		Mode:          info.Mode(),
+		ModTime:       info.ModTime(),
+		QuarantinedAt: time.Now(),
+	}
+	if uid, gid, ok := fileutils.FileOwner(info); ok {
+		entry.UID, entry.GID, entry.HasOwner = uid, gid, true
+	}
+
+	target := filepath.Join(root, entry.StoredPath)
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return Entry{}, fmt.Errorf("error creating quarantine directory: %v", err)
+	}
+	if _, err := os.Lstat(target); err == nil {
+		return Entry{}, fmt.Errorf("%s is already quarantined in run %s", absPath, runID)
+	}
+	if err := moveFile(absPath, target); err != nil {
+		return Entry{}, err
+	}
+
+	if err := appendManifest(root, entry); err != nil {
+		// Put the file back rather than leave it untracked
+		if restoreErr := moveFile(target, absPath); restoreErr != nil {
+			return Entry{}, fmt.Errorf("%v (file left at %s: %v)", err, target, restoreErr)
+		}
+		return Entry{}, err
+	}
+	return entry, nil
+}
+
+// Purge removes quarantined files that are older than maxAge and drops them
+// from the manifest. With dryRun set it only returns what would be purged.
+func Purge(root string, maxAge time.Duration, dryRun bool) ([]Entry, error) {
+	cutoff := time.Now().Add(-maxAge)
+	return removeEntries(root, func(entry Entry) bool {
+		return entry.QuarantinedAt.Before(cutoff)
+	}, dryRun, func(entry Entry) error {
+		err := os.Remove(filepath.Join(root, entry.StoredPath))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+// Restore moves every quarantined file selected by match back to its
+// original location with its original mode, owner and modification time.
+// Files whose original path is occupied again are left in quarantine.
+func Restore(root string, match func(Entry) bool) ([]Entry, error) {
+	return removeEntries(root, match, false, func(entry Entry) error {
+		if _, err := os.Lstat(entry.OriginalPath); err == nil {
+			return fmt.Errorf("%s already exists", entry.OriginalPath)
+		}
+		if err := os.MkdirAll(filepath.Dir(entry.OriginalPath), 0755); err != nil {
+			return err
+		}
+		if err := moveFile(filepath.Join(root, entry.StoredPath), entry.OriginalPath); err != nil {
+			return err
+		}
+		return restoreMetadata(entry)
+	})
+}
+
+// List returns every entry of the root's manifest
+func List(root string) ([]Entry, error) {
+	f, err := os.Open(filepath.Join(root, ManifestName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening quarantine manifest: %v", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("error decoding quarantine manifest line %d: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading quarantine manifest: %v", err)
+	}
+	return entries, nil
+}
+
+// removeEntries applies fn to every manifest entry selected by match and
+// rewrites the manifest without the entries fn succeeded for
+func removeEntries(root string, match func(Entry) bool, dryRun bool, fn func(Entry) error) ([]Entry, error) {
+	entries, err := List(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var done, remaining []Entry
+	var errs []error
+	for _, entry := range entries {
+		if !match(entry) {
+			remaining = append(remaining, entry)
+			continue
+		}
+		if dryRun {
+			done = append(done, entry)
+			remaining = append(remaining, entry)
+			continue
+		}
+		if err := fn(entry); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", entry.OriginalPath, err))
+			remaining = append(remaining, entry)
+			continue
+		}
+		done = append(done, entry)
+		removeEmptyParents(filepath.Dir(filepath.Join(root, entry.StoredPath)), root)
+	}
+
+	if !dryRun && len(done) > 0 {
+		if err := writeManifest(root, remaining); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return done, errors.Join(errs...)
+}
+
+func appendManifest(root string, entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(root, ManifestName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening quarantine manifest: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing quarantine manifest: %v", err)
+	}
+	return f.Close()
+}
+
+// writeManifest atomically replaces the manifest with entries
+func writeManifest(root string, entries []Entry) error {
+	tmp, err := os.CreateTemp(root, ManifestName+".*")
+	if err != nil {
+		return fmt.Errorf("error writing quarantine manifest: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			tmp.Close()
+			return fmt.Errorf("error writing quarantine manifest: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing quarantine manifest: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing quarantine manifest: %v", err)
+	}
+	return os.Rename(tmp.Name(), filepath.Join(root, ManifestName))
+}
+
+// restoreMetadata puts back the mode, owner and modification time of a
+// restored file. Ownership can only be restored when running as root. The
+// owner is set first, since changing it clears the setuid and setgid bits.
+func restoreMetadata(entry Entry) error {
+	if entry.Mode&os.ModeSymlink != 0 {
+		return nil
+	}
+	if entry.HasOwner {
+		if err := os.Lchown(entry.OriginalPath, entry.UID, entry.GID); err != nil && !errors.Is(err, os.ErrPermission) {
+			return err
+		}
+	}
+	if err := os.Chmod(entry.OriginalPath, entry.Mode&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+	return os.Chtimes(entry.OriginalPath, time.Now(), entry.ModTime)
+}
+
+// moveFile renames src to dst, copying across filesystems when needed
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(target, dst); err != nil {
+			return err
+		}
+	case info.Mode().IsRegular():
+		if err := copyFile(src, dst, info); err != nil {
+			os.Remove(dst)
+			return err
+		}
+	default:
+		return fmt.Errorf("cannot move %s across filesystems: not a regular file", src)
+	}
+	return os.Remove(src)
+}
+
+func copyFile(src, dst string, info os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, time.Now(), info.ModTime())
+}
+
+// removeEmptyParents removes dir and its parents up to, but not including,
+// root as long as they are empty
+func removeEmptyParents(dir, root string) {
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+	}
+}
+
+// relativeToVolume strips the volume name and leading separators from an
+// absolute path so it can be nested below the quarantine root
+func relativeToVolume(path string) string {
+	volume := filepath.VolumeName(path)
+	rel := strings.TrimLeft(strings.TrimPrefix(path, volume), `/\`)
+	if volume != "" {
+		rel = filepath.Join(strings.TrimSuffix(volume, ":"), rel)
+	}
+	return rel
+}
@@ -0,0 +1,193 @@
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arkag/dirclean/fileutils"
+)
+
+// ErrUnsupported is returned on platforms where files cannot be moved into a
+// freedesktop.org trash
+var ErrUnsupported = errors.New("trash is not supported on this platform")
+
+// Trash moves path into the freedesktop.org trash that belongs to the
+// filesystem it is on, writing the matching .trashinfo file, and returns the
+// location the file was moved to. Files on the same filesystem as the home
+// directory go to $XDG_DATA_HOME/Trash; files on other mounts go to
+// $topdir/.Trash/$uid if the administrator created $topdir/.Trash, otherwise
+// to $topdir/.Trash-$uid.
+func Trash(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := os.Lstat(absPath)
+	if err != nil {
+		return "", err
+	}
+	device, _, ok := fileutils.FileID(info)
+	if !ok {
+		return "", ErrUnsupported
+	}
+
+	trashDir, infoPath, err := findTrashDir(absPath, device)
+	if err != nil {
+		return "", err
+	}
+	return moveToTrash(absPath, trashDir, infoPath)
+}
+
+// findTrashDir returns the trash directory to use for a file on device, and
+// the path to record in the .trashinfo file
+func findTrashDir(absPath string, device uint64) (trashDir, infoPath string, err error) {
+	homeTrash, err := homeTrashDir()
+	if err != nil {
+		return "", "", err
+	}
+	if homeDevice, ok := deviceOf(existingParent(homeTrash)); ok && homeDevice == device {
+		return homeTrash, absPath, nil
+	}
+
+	topDir := mountPoint(absPath, device)
+	uid := strconv.Itoa(os.Getuid())
+
+	// Use the administrator-provided $topdir/.Trash if it is safe to and
+	// the user's directory in it can be created, else $topdir/.Trash-$uid
+	relPath, err := filepath.Rel(topDir, absPath)
+	if err != nil {
+		return "", "", err
+	}
+	shared := filepath.Join(topDir, ".Trash")
+	if info, err := os.Lstat(shared); err == nil && info.IsDir() && info.Mode()&os.ModeSticky != 0 {
+		userTrash := filepath.Join(shared, uid)
+		if err := os.Mkdir(userTrash, 0700); err == nil || os.IsExist(err) {
+			if info, err := os.Lstat(userTrash); err == nil && info.IsDir() {
+				return userTrash, relPath, nil
+			}
+		}
+	}
+	return filepath.Join(topDir, ".Trash-"+uid), relPath, nil
+}
+
+// homeTrashDir returns $XDG_DATA_HOME/Trash, defaulting to ~/.local/share/Trash
+func homeTrashDir() (string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("cannot locate home trash: %v", err)
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "Trash"), nil
+}
+
+// moveToTrash reserves a unique name in trashDir by creating its .trashinfo
+// file exclusively, then renames the file into trashDir/files
+func moveToTrash(absPath, trashDir, infoPath string) (string, error) {
+	filesDir := filepath.Join(trashDir, "files")
+	infoDir := filepath.Join(trashDir, "info")
+	for _, dir := range []string{filesDir, infoDir} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return "", fmt.Errorf("error creating trash directory: %v", err)
+		}
+	}
+	if info, err := os.Lstat(trashDir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("trash directory %s is not a directory", trashDir)
+	}
+
+	contents := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		escapePath(infoPath), time.Now().Format("2006-01-02T15:04:05"))
+
+	base := filepath.Base(absPath)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	for i := 1; ; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s.%d%s", stem, i, ext)
+		}
+
+		infoFile := filepath.Join(infoDir, name+".trashinfo")
+		f, err := os.OpenFile(infoFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("error creating trash info file: %v", err)
+		}
+
+		target := filepath.Join(filesDir, name)
+		if _, err := os.Lstat(target); err == nil {
+			// A leftover file without info, keep looking for a free name
+			f.Close()
+			os.Remove(infoFile)
+			continue
+		}
+
+		_, writeErr := f.WriteString(contents)
+		closeErr := f.Close()
+		if writeErr != nil || closeErr != nil {
+			os.Remove(infoFile)
+			return "", fmt.Errorf("error writing trash info file: %v", errors.Join(writeErr, closeErr))
+		}
+
+		if err := os.Rename(absPath, target); err != nil {
+			os.Remove(infoFile)
+			return "", fmt.Errorf("error moving %s to trash: %v", absPath, err)
+		}
+		return target, nil
+	}
+}
+
+// escapePath percent-encodes a path as required for the Path key
+func escapePath(path string) string {
+	return (&url.URL{Path: filepath.ToSlash(path)}).EscapedPath()
+}
+
+// mountPoint returns the top directory of the filesystem path is on by
+// walking up until the parent is on a different device
+func mountPoint(path string, device uint64) string {
+	dir := filepath.Dir(path)
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		if parentDevice, ok := deviceOf(parent); !ok || parentDevice != device {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// existingParent returns path or its closest ancestor that exists
+func existingParent(path string) string {
+	for {
+		if _, err := os.Lstat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
+func deviceOf(path string) (uint64, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, false
+	}
+	device, _, ok := fileutils.FileID(info)
+	return device, ok
+}